@@ -0,0 +1,83 @@
+package kempclient
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// These are the scopes of a restore.
+const (
+	RestoreBaseConfig      = "1"
+	RestoreVirtualServices = "2"
+	RestoreAll             = "3"
+)
+
+type BackupResponse struct {
+	Debug   string   `xml:",innerxml"`
+	XMLName xml.Name `xml:"Response"`
+}
+
+// Backup downloads the backup archive of the LoadMaster and writes it to w.
+func (c *Client) Backup(ctx context.Context, w io.Writer) error {
+	res, err := c.requestStream(ctx, "GET", "backup", make(map[string]string), nil)
+	if err != nil {
+		return errgo.NoteMask(err, "kemp unable to download backup", errgo.Any)
+	}
+	defer res.Body.Close()
+
+	// The LoadMaster answers with a XML document instead of the archive if the
+	// backup failed.
+	if strings.Contains(res.Header.Get("Content-Type"), "xml") {
+		errorResponse := ErrorResponse{}
+		if err := c.parseResponse(res.Body, &errorResponse); err != nil {
+			return errgo.NoteMask(err, "kemp unable to parse backup response", errgo.Any)
+		}
+		return errgo.Newf("kemp unable to download backup: %s", errorResponse.Error)
+	}
+
+	n, err := io.Copy(w, res.Body)
+	if err != nil {
+		return errgo.NoteMask(err, "kemp unable to download backup", errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG: downloaded backup of", n, "bytes")
+	}
+
+	return nil
+}
+
+// Restore uploads the backup archive read from r and restores the given scope,
+// one of RestoreBaseConfig, RestoreVirtualServices or RestoreAll.
+func (c *Client) Restore(ctx context.Context, r io.Reader, scope string) error {
+	switch scope {
+	case RestoreBaseConfig, RestoreVirtualServices, RestoreAll:
+	default:
+		return errgo.Newf("%s is not a valid restore scope", scope)
+	}
+
+	parameters := make(map[string]string)
+	parameters["type"] = scope
+
+	res, err := c.requestStream(ctx, "POST", "restore", parameters, r)
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to restore backup '%#v'", parameters), errgo.Any)
+	}
+	defer res.Body.Close()
+
+	data := BackupResponse{}
+	if err := c.parseSuccess(res.Body, &data); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	return nil
+}
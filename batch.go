@@ -0,0 +1,320 @@
+package kempclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// DefaultBatchWorkers is the number of operations ExecuteBatch runs
+// concurrently if no worker limit is given.
+const DefaultBatchWorkers = 4
+
+// BatchOperation is a single operation of a batch. Operations without
+// dependencies between them are run concurrently.
+//
+// Operations created by the *Operation functions also know which virtual
+// services and content rules they create and require, e.g. a request rule is
+// only attached after the content rule and the virtual service in the same
+// batch have been added. Deletions run in the reverse order, e.g. a content
+// rule is only deleted after it has been detached and the virtual services in
+// the same batch have been deleted. DependsOn adds explicit dependencies by ID.
+type BatchOperation struct {
+	ID        string
+	DependsOn []string
+	Run       func(c *Client) error
+
+	// creates are the resources the operation provides, e.g. a virtual
+	// service, or for deletions the release of a resource. requires are the
+	// resources which have to be provided first.
+	creates  []string
+	requires []string
+}
+
+// BatchResult is the result of a single operation of a batch.
+type BatchResult struct {
+	ID  string
+	Err error
+	// Skipped is true if the operation has not been run as one of its
+	// dependencies failed.
+	Skipped bool
+}
+
+func AddVirtualServiceOperation(id string, vs VirtualServiceParams, dependsOn ...string) BatchOperation {
+	requires := []string{}
+	for _, rules := range [][]string{vs.ContentRequestRules, vs.ContentResponseRules, vs.ContentPreProcessRules} {
+		for _, rule := range rules {
+			requires = append(requires, contentRuleResource(rule))
+		}
+	}
+
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			_, err := c.AddVirtualService(vs)
+			return err
+		},
+		creates:  []string{virtualServiceResource(vs.IPAddress, vs.Port, vs.Protocol)},
+		requires: requires,
+	}
+}
+
+func DeleteVirtualServiceOperation(id, ip, port, protocol string, dependsOn ...string) BatchOperation {
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			return c.DeleteVirtualServiceByData(ip, port, protocol)
+		},
+		// Deleting the virtual service detaches all its rules.
+		creates:  []string{releasedContentRulesResource},
+		requires: []string{releasedVirtualServiceResource(ip, port, protocol)},
+	}
+}
+
+func AddRealServerOperation(id, ip, port, protocol string, rs RealServer, dependsOn ...string) BatchOperation {
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			return c.AddRealServerByData(ip, port, protocol, rs)
+		},
+		requires: []string{virtualServiceResource(ip, port, protocol)},
+	}
+}
+
+func DeleteRealServerOperation(id, ip, port, protocol string, rs RealServer, dependsOn ...string) BatchOperation {
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			return c.DeleteRealServerByData(ip, port, protocol, rs)
+		},
+		creates: []string{releasedVirtualServiceResource(ip, port, protocol)},
+	}
+}
+
+func AddContentRuleOperation(id string, rule ContentRule, dependsOn ...string) BatchOperation {
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			return c.AddContentRule(rule)
+		},
+		creates: []string{contentRuleResource(rule.Name)},
+	}
+}
+
+func DeleteContentRuleOperation(id, name string, dependsOn ...string) BatchOperation {
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			return c.DeleteContentRule(name)
+		},
+		requires: []string{releasedContentRuleResource(name), releasedContentRulesResource},
+	}
+}
+
+func AddRequestRuleOperation(id, ip, port, protocol, rule string, dependsOn ...string) BatchOperation {
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			return c.AddRequestRuleByData(ip, port, protocol, rule)
+		},
+		requires: []string{virtualServiceResource(ip, port, protocol), contentRuleResource(rule)},
+	}
+}
+
+func DeleteRequestRuleOperation(id, ip, port, protocol, rule string, dependsOn ...string) BatchOperation {
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			return c.DeleteRequestRuleByData(ip, port, protocol, rule)
+		},
+		creates: []string{releasedVirtualServiceResource(ip, port, protocol), releasedContentRuleResource(rule)},
+	}
+}
+
+func virtualServiceResource(ip, port, protocol string) string {
+	return fmt.Sprintf("vs/%s/%s/%s", ip, port, protocol)
+}
+
+func contentRuleResource(name string) string {
+	return "rule/" + name
+}
+
+// The released resources are provided by deletions which have to run before
+// the resource itself is deleted.
+
+// releasedContentRulesResource is provided by deletions which detach any
+// content rule.
+const releasedContentRulesResource = "released/rules"
+
+func releasedVirtualServiceResource(ip, port, protocol string) string {
+	return "released/" + virtualServiceResource(ip, port, protocol)
+}
+
+func releasedContentRuleResource(name string) string {
+	return "released/" + contentRuleResource(name)
+}
+
+// ExecuteBatch runs the operations with at most workers operations at the same
+// time. An operation is run once all operations it depends on succeeded, if
+// one of them failed the operation is skipped. The results are in the order of
+// the operations. An error is only returned if the batch itself is invalid,
+// e.g. it has unknown or circular dependencies.
+func (c *Client) ExecuteBatch(operations []BatchOperation, workers int) ([]BatchResult, error) {
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+
+	dependents, pending, err := batchDependencies(operations)
+	if err != nil {
+		return []BatchResult{}, errgo.Mask(err)
+	}
+
+	results := make([]BatchResult, len(operations))
+	for i, op := range operations {
+		results[i].ID = op.ID
+	}
+	if len(operations) == 0 {
+		return results, nil
+	}
+
+	type done struct {
+		index int
+		err   error
+	}
+
+	ready := make(chan int, len(operations))
+	finished := make(chan done)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range ready {
+				finished <- done{index: i, err: operations[i].Run(c)}
+			}
+		}()
+	}
+
+	failedDependency := make([]bool, len(operations))
+	completed := 0
+
+	var complete func(i int)
+	complete = func(i int) {
+		completed++
+		for _, d := range dependents[i] {
+			if results[i].Err != nil || results[i].Skipped {
+				failedDependency[d] = true
+			}
+			pending[d]--
+			if pending[d] > 0 {
+				continue
+			}
+			if failedDependency[d] {
+				results[d].Skipped = true
+				complete(d)
+				continue
+			}
+			ready <- d
+		}
+	}
+
+	for i := range operations {
+		if pending[i] == 0 {
+			ready <- i
+		}
+	}
+
+	for completed < len(operations) {
+		d := <-finished
+		results[d.index].Err = d.err
+		complete(d.index)
+	}
+	close(ready)
+
+	if c.debug {
+		fmt.Println("DEBUG: executed batch of", len(operations), "operations")
+	}
+
+	return results, nil
+}
+
+// batchDependencies returns the dependents of every operation and the number
+// of operations every operation depends on.
+func batchDependencies(operations []BatchOperation) ([][]int, []int, error) {
+	index := make(map[string]int)
+	creators := make(map[string][]int)
+	for i, op := range operations {
+		if op.Run == nil {
+			return nil, nil, errgo.Newf("batch operation %s has nothing to run", op.ID)
+		}
+		if _, ok := index[op.ID]; ok {
+			return nil, nil, errgo.Newf("batch operation %s is not unique", op.ID)
+		}
+		index[op.ID] = i
+
+		for _, resource := range op.creates {
+			creators[resource] = append(creators[resource], i)
+		}
+	}
+
+	dependents := make([][]int, len(operations))
+	pending := make([]int, len(operations))
+	for i, op := range operations {
+		dependencies := make(map[int]bool)
+		for _, id := range op.DependsOn {
+			d, ok := index[id]
+			if !ok {
+				return nil, nil, errgo.Newf("batch operation %s depends on unknown operation %s", op.ID, id)
+			}
+			dependencies[d] = true
+		}
+		for _, resource := range op.requires {
+			for _, d := range creators[resource] {
+				dependencies[d] = true
+			}
+		}
+		delete(dependencies, i)
+
+		for d := range dependencies {
+			dependents[d] = append(dependents[d], i)
+			pending[i]++
+		}
+	}
+
+	// Make sure every operation can be run eventually.
+	remaining := append([]int{}, pending...)
+	queue := []int{}
+	for i := range operations {
+		if remaining[i] == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, d := range dependents[i] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	circular := []string{}
+	for i, op := range operations {
+		if remaining[i] > 0 {
+			circular = append(circular, op.ID)
+		}
+	}
+	if len(circular) > 0 {
+		return nil, nil, errgo.Newf("batch operations %s have circular dependencies", strings.Join(circular, ", "))
+	}
+
+	return dependents, pending, nil
+}
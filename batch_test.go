@@ -0,0 +1,302 @@
+package kempclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func recordingOperation(id string, log *[]string, mutex *sync.Mutex, err error, dependsOn ...string) BatchOperation {
+	return BatchOperation{
+		ID:        id,
+		DependsOn: dependsOn,
+		Run: func(c *Client) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			*log = append(*log, id)
+			return err
+		},
+	}
+}
+
+func TestBatchDependenciesInferredFromResources(t *testing.T) {
+	vs := VirtualServiceParams{
+		IPAddress:           "10.0.0.1",
+		Port:                "80",
+		Protocol:            "tcp",
+		ContentRequestRules: []string{"rule1"},
+	}
+	operations := []BatchOperation{
+		AddRequestRuleOperation("attach", "10.0.0.1", "80", "tcp", "rule2"),
+		AddRealServerOperation("rs", "10.0.0.1", "80", "tcp", RealServer{IPAddress: "10.0.1.1", Port: "8080"}),
+		AddVirtualServiceOperation("vs", vs),
+		AddContentRuleOperation("rule1", NewDeleteHeaderRule("rule1", "X-Test")),
+		AddContentRuleOperation("rule2", NewDeleteHeaderRule("rule2", "X-Test")),
+	}
+
+	dependents, pending, err := batchDependencies(operations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedPending := []int{2, 1, 1, 0, 0}
+	for i, p := range expectedPending {
+		if pending[i] != p {
+			t.Errorf("operation %s: expected %d dependencies, got %d", operations[i].ID, p, pending[i])
+		}
+	}
+
+	has := func(from, to int) bool {
+		for _, d := range dependents[from] {
+			if d == to {
+				return true
+			}
+		}
+		return false
+	}
+	for _, edge := range [][2]int{{2, 0}, {4, 0}, {2, 1}, {3, 2}} {
+		if !has(edge[0], edge[1]) {
+			t.Errorf("expected %s to depend on %s", operations[edge[1]].ID, operations[edge[0]].ID)
+		}
+	}
+}
+
+func TestExecuteBatchOrder(t *testing.T) {
+	var log []string
+	var mutex sync.Mutex
+	operations := []BatchOperation{
+		recordingOperation("c", &log, &mutex, nil, "b"),
+		recordingOperation("b", &log, &mutex, nil, "a"),
+		recordingOperation("a", &log, &mutex, nil),
+	}
+
+	results, err := NewClient(Config{}).ExecuteBatch(operations, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(log, ",") != "a,b,c" {
+		t.Errorf("expected operations to run in order a,b,c, got %s", strings.Join(log, ","))
+	}
+	for i, result := range results {
+		if result.ID != operations[i].ID {
+			t.Errorf("result %d: expected ID %s, got %s", i, operations[i].ID, result.ID)
+		}
+		if result.Err != nil || result.Skipped {
+			t.Errorf("result %s: expected success, got %#v", result.ID, result)
+		}
+	}
+}
+
+func TestExecuteBatchSkipsDependents(t *testing.T) {
+	var log []string
+	var mutex sync.Mutex
+	failure := errors.New("failed")
+	operations := []BatchOperation{
+		recordingOperation("a", &log, &mutex, failure),
+		recordingOperation("b", &log, &mutex, nil, "a"),
+		recordingOperation("c", &log, &mutex, nil, "b"),
+		recordingOperation("d", &log, &mutex, nil),
+		recordingOperation("e", &log, &mutex, nil, "c", "d"),
+	}
+
+	results, err := NewClient(Config{}).ExecuteBatch(operations, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if results[0].Err != failure || results[0].Skipped {
+		t.Errorf("expected a to fail, got %#v", results[0])
+	}
+	for _, i := range []int{1, 2, 4} {
+		if !results[i].Skipped || results[i].Err != nil {
+			t.Errorf("expected %s to be skipped, got %#v", results[i].ID, results[i])
+		}
+	}
+	if results[3].Skipped || results[3].Err != nil {
+		t.Errorf("expected d to succeed, got %#v", results[3])
+	}
+
+	sortedLog := strings.Join(log, ",")
+	if sortedLog != "a,d" && sortedLog != "d,a" {
+		t.Errorf("expected only a and d to run, got %s", sortedLog)
+	}
+}
+
+func TestExecuteBatchInvalid(t *testing.T) {
+	run := func(c *Client) error { return nil }
+
+	tests := []struct {
+		name       string
+		operations []BatchOperation
+		message    string
+	}{
+		{
+			name: "circular",
+			operations: []BatchOperation{
+				{ID: "a", DependsOn: []string{"c"}, Run: run},
+				{ID: "b", DependsOn: []string{"a"}, Run: run},
+				{ID: "c", DependsOn: []string{"b"}, Run: run},
+				{ID: "d", Run: run},
+			},
+			message: "batch operations a, b, c have circular dependencies",
+		},
+		{
+			name: "circular resources",
+			operations: []BatchOperation{
+				AddRequestRuleOperation("attach", "10.0.0.1", "80", "tcp", "rule"),
+				AddVirtualServiceOperation("vs", VirtualServiceParams{IPAddress: "10.0.0.1", Port: "80", Protocol: "tcp"}, "attach"),
+				AddContentRuleOperation("rule", NewDeleteHeaderRule("rule", "X-Test")),
+			},
+			message: "batch operations attach, vs have circular dependencies",
+		},
+		{
+			name: "unknown",
+			operations: []BatchOperation{
+				{ID: "a", DependsOn: []string{"b"}, Run: run},
+			},
+			message: "batch operation a depends on unknown operation b",
+		},
+		{
+			name: "duplicate",
+			operations: []BatchOperation{
+				{ID: "a", Run: run},
+				{ID: "a", Run: run},
+			},
+			message: "batch operation a is not unique",
+		},
+		{
+			name: "nothing to run",
+			operations: []BatchOperation{
+				{ID: "a"},
+			},
+			message: "batch operation a has nothing to run",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := NewClient(Config{}).ExecuteBatch(test.operations, 1)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected error %q, got %q", test.name, test.message, err.Error())
+		}
+	}
+}
+
+func TestAddProtoPortHeaderRequestRulesConcurrently(t *testing.T) {
+	var mutex sync.Mutex
+	rules := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/showrule":
+			fmt.Fprint(w, `<Response stat="200" code="ok"><Success><Data>`)
+			for name := range rules {
+				fmt.Fprintf(w, `<DeleteHeaderRule><Name>%s</Name></DeleteHeaderRule>`, name)
+			}
+			fmt.Fprint(w, `</Data></Success></Response>`)
+		case "/addrule":
+			name := r.URL.Query().Get("name")
+			if rules[name] {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprintf(w, `<Response stat="422" code="fail"><Error>Rule %s already exists</Error></Response>`, name)
+				return
+			}
+			rules[name] = true
+			fmt.Fprint(w, `<Response stat="200" code="ok"><Success>Command completed ok</Success></Response>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Response stat="404" code="fail"><Error>Unknown command</Error></Response>`)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(Config{Endpoint: server.URL + "/"})
+
+	operations := []BatchOperation{}
+	for i := 0; i < 4; i++ {
+		operations = append(operations, BatchOperation{
+			ID:  fmt.Sprintf("rules%d", i),
+			Run: func(c *Client) error { return c.AddProtoPortHeaderRequestRules() },
+		})
+	}
+
+	results, err := c.ExecuteBatch(operations, len(operations))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("%s: unexpected error: %v", result.ID, result.Err)
+		}
+	}
+	if !rules[DeleteHeaderProtoName] || !rules[DeleteHeaderPortName] {
+		t.Errorf("expected both shared rules to be added, got %v", rules)
+	}
+}
+
+func TestExecuteBatchTeardownOrder(t *testing.T) {
+	fake, c := newFakeLoadMaster(t)
+
+	operations := []BatchOperation{
+		DeleteContentRuleOperation("delrule", "rule"),
+		DeleteVirtualServiceOperation("delvs", "10.0.0.1", "80", "tcp"),
+		DeleteRealServerOperation("delrs", "10.0.0.1", "80", "tcp", RealServer{IPAddress: "10.0.1.1", Port: "8080"}),
+		DeleteRequestRuleOperation("delrequestrule", "10.0.0.1", "80", "tcp", "rule"),
+		DeleteContentRuleOperation("delother", "other"),
+	}
+
+	_, pending, err := batchDependencies(operations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedPending := []int{2, 2, 0, 0, 1}
+	for i, p := range expectedPending {
+		if pending[i] != p {
+			t.Errorf("operation %s: expected %d dependencies, got %d", operations[i].ID, p, pending[i])
+		}
+	}
+
+	results, err := c.ExecuteBatch(operations, len(operations))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, result := range results {
+		if result.Err != nil || result.Skipped {
+			t.Errorf("%s: expected success, got %#v", result.ID, result)
+		}
+	}
+
+	sent := fake.sent()
+	index := func(prefix string) int {
+		for i, command := range sent {
+			if strings.HasPrefix(command, prefix) {
+				return i
+			}
+		}
+		t.Fatalf("%s has not been sent: %v", prefix, sent)
+		return -1
+	}
+
+	for _, order := range [][2]string{
+		{"delrequestrule", "delvs"},
+		{"delrs", "delvs"},
+		{"delrequestrule", "delrule name=rule"},
+		{"delvs", "delrule name=rule"},
+		{"delvs", "delrule name=other"},
+	} {
+		if index(order[0]) > index(order[1]) {
+			t.Errorf("expected %s before %s, got %v", order[0], order[1], sent)
+		}
+	}
+}
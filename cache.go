@@ -0,0 +1,124 @@
+package kempclient
+
+import (
+	"sync"
+	"time"
+)
+
+// cache holds the results of reading commands for a limited time. A nil cache
+// does not cache anything.
+//
+// Every invalidation increments the generation. Readers record the generation
+// before sending their request and pass it to set, so that results of reads
+// which overlapped a change are dropped instead of being cached.
+type cache struct {
+	mutex      sync.Mutex
+	ttl        time.Duration
+	entries    map[string]cacheEntry
+	generation uint64
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newCache(ttl time.Duration) *cache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &cache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *cache) get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+// currentGeneration returns the generation to pass to set for a read that is
+// about to be sent.
+func (c *cache) currentGeneration() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.generation
+}
+
+// set stores the value unless the cache has been invalidated since generation
+// was read.
+func (c *cache) set(key string, value interface{}, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *cache) invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]cacheEntry)
+}
+
+// Invalidate drops all cached results. The cache is invalidated automatically
+// by every changing request of this client, Invalidate is only needed if the
+// LoadMaster has been changed by someone else.
+func (c *Client) Invalidate() {
+	c.cache.invalidate()
+}
+
+func copyVirtualServices(list []VirtualService) []VirtualService {
+	result := make([]VirtualService, len(list))
+	for i, vs := range list {
+		result[i] = copyVirtualService(vs)
+	}
+
+	return result
+}
+
+func copyVirtualService(vs VirtualService) VirtualService {
+	vs.InterceptOpts = append([]string(nil), vs.InterceptOpts...)
+	vs.Rs = append([]RealServer(nil), vs.Rs...)
+	vs.MatchRules = append([]string(nil), vs.MatchRules...)
+	vs.RequestRules = append([]string(nil), vs.RequestRules...)
+	vs.ResponseRules = append([]string(nil), vs.ResponseRules...)
+	vs.PreProcessRules = append([]string(nil), vs.PreProcessRules...)
+
+	return vs
+}
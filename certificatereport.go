@@ -0,0 +1,123 @@
+package kempclient
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+// DefaultCertificateExpiryWarning is how long before its expiry a certificate
+// is reported as expiring soon if no other duration is given.
+const DefaultCertificateExpiryWarning = 30 * 24 * time.Hour
+
+// CertificateReport lists the expiry and the usage of all certificates.
+type CertificateReport struct {
+	GeneratedAt  time.Time           `json:"generatedAt"`
+	Certificates []CertificateStatus `json:"certificates"`
+}
+
+// CertificateStatus is the expiry and usage of a certificate. DaysToExpiry is
+// negative once the certificate expired. Intermediate certificates are never
+// assigned to a virtual service, so they are not reported as unused.
+type CertificateStatus struct {
+	Name            string                      `json:"name"`
+	Intermediate    bool                        `json:"intermediate"`
+	Subject         string                      `json:"subject"`
+	DNSNames        []string                    `json:"dnsNames"`
+	NotAfter        time.Time                   `json:"notAfter"`
+	DaysToExpiry    int                         `json:"daysToExpiry"`
+	VirtualServices []CertificateVirtualService `json:"virtualServices"`
+	Unused          bool                        `json:"unused"`
+	ExpiringSoon    bool                        `json:"expiringSoon"`
+	Expired         bool                        `json:"expired"`
+}
+
+// CertificateVirtualService is a virtual service serving a certificate.
+type CertificateVirtualService struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// CertificateReport lists all certificates and intermediate certificates with
+// the virtual services serving them. Certificates expiring within warning are
+// flagged as expiring soon, a warning of 0 uses
+// DefaultCertificateExpiryWarning.
+func (c *Client) CertificateReport(warning time.Duration) (CertificateReport, error) {
+	certificates, err := c.ListCertificates()
+	if err != nil {
+		return CertificateReport{}, errgo.Mask(err, errgo.Any)
+	}
+
+	intermediates, err := c.ListIntermediateCertificates()
+	if err != nil {
+		return CertificateReport{}, errgo.Mask(err, errgo.Any)
+	}
+
+	list, err := c.ListVirtualServices()
+	if err != nil {
+		return CertificateReport{}, errgo.Mask(err, errgo.Any)
+	}
+
+	return NewCertificateReport(append(certificates, intermediates...), list, time.Now(), warning), nil
+}
+
+// NewCertificateReport builds the report for the given certificates and
+// virtual services at the time now.
+func NewCertificateReport(certificates []Certificate, virtualServices []VirtualService, now time.Time, warning time.Duration) CertificateReport {
+	if warning <= 0 {
+		warning = DefaultCertificateExpiryWarning
+	}
+
+	users := make(map[string][]CertificateVirtualService)
+	for _, vs := range virtualServices {
+		for _, name := range vs.Certificates() {
+			users[name] = append(users[name], CertificateVirtualService{
+				ID:      vs.ID,
+				Name:    vs.Name,
+				Address: virtualServiceKey(vs),
+			})
+		}
+	}
+
+	report := CertificateReport{
+		GeneratedAt:  now.UTC(),
+		Certificates: []CertificateStatus{},
+	}
+	for _, cert := range certificates {
+		status := CertificateStatus{
+			Name:            cert.Name,
+			Intermediate:    cert.Intermediate,
+			Subject:         cert.Subject,
+			DNSNames:        cert.DNSNames,
+			NotAfter:        cert.NotAfter,
+			DaysToExpiry:    int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24)),
+			VirtualServices: []CertificateVirtualService{},
+			Expired:         !now.Before(cert.NotAfter),
+		}
+		if !cert.Intermediate {
+			status.VirtualServices = append(status.VirtualServices, users[cert.Name]...)
+			status.Unused = len(status.VirtualServices) == 0
+		}
+		status.ExpiringSoon = !status.Expired && cert.NotAfter.Sub(now) < warning
+
+		report.Certificates = append(report.Certificates, status)
+	}
+
+	sort.Slice(report.Certificates, func(i, j int) bool {
+		return report.Certificates[i].NotAfter.Before(report.Certificates[j].NotAfter)
+	})
+
+	return report
+}
+
+func (r CertificateReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return errgo.Mask(encoder.Encode(r))
+}
@@ -0,0 +1,119 @@
+package kempclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// Certificates returns the names of the certificates served by the virtual
+// service. More than one certificate is selected by SNI.
+func (vs VirtualService) Certificates() []string {
+	return splitList(vs.CertFile)
+}
+
+// UsesCertificate returns whether the virtual service serves the certificate.
+func (vs VirtualService) UsesCertificate(name string) bool {
+	for _, cert := range vs.Certificates() {
+		if cert == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AssignCertificates replaces the certificates served by the virtual service.
+// If more than one certificate is given, the LoadMaster selects one by SNI.
+func (c *Client) AssignCertificates(vsID int, names ...string) error {
+	if len(names) == 0 {
+		return errgo.New("at least one certificate is needed")
+	}
+	for _, name := range names {
+		if err := validateCertificateName(name); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+
+	parameters := make(map[string]string)
+	parameters["vs"] = strconv.Itoa(vsID)
+	parameters["certfile"] = strings.Join(names, " ")
+
+	data := VirtualServiceResponse{}
+	err := c.Request("modvs", parameters, &data)
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to assign certificates '%#v'", parameters), errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	return nil
+}
+
+// RotateCertificate uploads a new certificate under newName, swaps it in for
+// oldName on every virtual service serving oldName, verifies the swap and
+// deletes the old certificate. It returns the IDs of the swapped virtual
+// services. If a step fails after others have been completed, they are undone
+// and a *RollbackError is returned.
+func (c *Client) RotateCertificate(oldName, newName string, pemCert, pemKey []byte) ([]int, error) {
+	if oldName == newName {
+		return nil, errgo.New("the new certificate needs a different name")
+	}
+
+	j := &journal{}
+
+	if err := c.UploadCertificate(newName, pemCert, pemKey); err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+	j.record("addcert "+newName, func() error {
+		return c.DeleteCertificate(newName)
+	})
+
+	list, err := c.ListVirtualServices()
+	if err != nil {
+		return nil, j.rollback(err)
+	}
+
+	swapped := []int{}
+	for _, vs := range list {
+		if !vs.UsesCertificate(oldName) {
+			continue
+		}
+
+		id, before := vs.ID, vs.Certificates()
+		after := []string{}
+		for _, name := range before {
+			if name == oldName {
+				name = newName
+			}
+			after = append(after, name)
+		}
+
+		if err := c.AssignCertificates(id, after...); err != nil {
+			return nil, j.rollback(err)
+		}
+		j.record("modvs "+strconv.Itoa(id)+" certfile", func() error {
+			return c.AssignCertificates(id, before...)
+		})
+
+		current, err := c.ShowVirtualServiceByID(id)
+		if err != nil {
+			return nil, j.rollback(err)
+		}
+		if !current.UsesCertificate(newName) || current.UsesCertificate(oldName) {
+			return nil, j.rollback(errgo.Newf("virtual service %d serves '%s' instead of '%s'", id, current.CertFile, strings.Join(after, " ")))
+		}
+
+		swapped = append(swapped, id)
+	}
+
+	if err := c.DeleteCertificate(oldName); err != nil {
+		return nil, j.rollback(err)
+	}
+
+	return swapped, nil
+}
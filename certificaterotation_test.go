@@ -0,0 +1,163 @@
+package kempclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// certificateLoadMaster keeps the certificates assigned to the virtual
+// services of a fakeLoadMaster.
+type certificateLoadMaster struct {
+	mutex     sync.Mutex
+	certFiles map[string]string
+}
+
+func (l *certificateLoadMaster) virtualService(id string) string {
+	return fmt.Sprintf("<Index>%s</Index><CertFile>%s</CertFile>", id, l.certFiles[id])
+}
+
+func (l *certificateLoadMaster) listvs(query url.Values) (int, string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return http.StatusOK, `<Response stat="200" code="ok"><Success><Data>` +
+		"<VS>" + l.virtualService("1") + "</VS><VS>" + l.virtualService("2") + "</VS><VS><Index>3</Index></VS>" +
+		`</Data></Success></Response>`
+}
+
+func (l *certificateLoadMaster) showvs(query url.Values) (int, string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return http.StatusOK, `<Response stat="200" code="ok"><Success><Data>` + l.virtualService(query.Get("vs")) + `</Data></Success></Response>`
+}
+
+func TestRotateCertificateRollback(t *testing.T) {
+	pemCert, pemKey := testCertificate(t)
+
+	tests := []struct {
+		name string
+		// failing and ignored return whether modvs fails or succeeds without
+		// changing the certificates.
+		failing  func(query url.Values) bool
+		ignored  func(query url.Values) bool
+		fail     map[string]string
+		expected []string
+	}{
+		{
+			name: "upload",
+			fail: map[string]string{"cert": "new"},
+			expected: []string{
+				"addcert cert=new&replace=0",
+			},
+		},
+		{
+			name:    "reassign",
+			failing: func(query url.Values) bool { return query.Get("vs") == "2" && query.Get("certfile") == "other new" },
+			expected: []string{
+				"addcert cert=new&replace=0",
+				"modvs certfile=new&vs=1",
+				"modvs certfile=other+new&vs=2",
+				"modvs certfile=old&vs=1",
+				"delcert cert=new",
+			},
+		},
+		{
+			name:    "verify",
+			ignored: func(query url.Values) bool { return query.Get("vs") == "2" && query.Get("certfile") == "other new" },
+			expected: []string{
+				"addcert cert=new&replace=0",
+				"modvs certfile=new&vs=1",
+				"modvs certfile=other+new&vs=2",
+				"modvs certfile=other+old&vs=2",
+				"modvs certfile=old&vs=1",
+				"delcert cert=new",
+			},
+		},
+		{
+			name: "delete",
+			fail: map[string]string{"cert": "old"},
+			expected: []string{
+				"addcert cert=new&replace=0",
+				"modvs certfile=new&vs=1",
+				"modvs certfile=other+new&vs=2",
+				"delcert cert=old",
+				"modvs certfile=other+old&vs=2",
+				"modvs certfile=old&vs=1",
+				"delcert cert=new",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, c := newFakeLoadMaster(t)
+			lm := &certificateLoadMaster{certFiles: map[string]string{"1": "old", "2": "other old"}}
+			fake.handle("listvs", lm.listvs)
+			fake.handle("showvs", lm.showvs)
+			fake.handle("modvs", func(query url.Values) (int, string) {
+				if test.failing != nil && test.failing(query) {
+					return http.StatusUnprocessableEntity, `<Response stat="422" code="fail"><Error>Injected failure</Error></Response>`
+				}
+				if test.ignored == nil || !test.ignored(query) {
+					lm.mutex.Lock()
+					lm.certFiles[query.Get("vs")] = query.Get("certfile")
+					lm.mutex.Unlock()
+				}
+				return http.StatusOK, fakeSuccess
+			})
+			if test.fail != nil {
+				fake.fail("addcert", test.fail)
+				fake.fail("delcert", test.fail)
+			}
+
+			_, err := c.RotateCertificate("old", "new", pemCert, pemKey)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if rollbackErr, ok := err.(*RollbackError); ok && len(rollbackErr.RollbackErrors) != 0 {
+				t.Errorf("unexpected rollback errors %v", rollbackErr.RollbackErrors)
+			}
+
+			expectCommands(t, fake.sent("addcert", "modvs", "delcert"), test.expected)
+			if lm.certFiles["1"] != "old" || lm.certFiles["2"] != "other old" {
+				t.Errorf("expected the old certificates to be assigned again, got %v", lm.certFiles)
+			}
+		})
+	}
+}
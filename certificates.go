@@ -0,0 +1,293 @@
+package kempclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const maxCertificateNameLength = 64
+
+type CertificateResponse struct {
+	Debug   string   `xml:",innerxml"`
+	XMLName xml.Name `xml:"Response"`
+}
+
+type CertificateListResponse struct {
+	Debug   string          `xml:",innerxml"`
+	XMLName xml.Name        `xml:"Response"`
+	Data    CertificateList `xml:"Success>Data"`
+}
+
+type CertificateList struct {
+	Certificates []CertificateData `xml:"cert"`
+}
+
+type CertificateData struct {
+	Name string `xml:"name"`
+}
+
+type CertificateReadResponse struct {
+	Debug       string   `xml:",innerxml"`
+	XMLName     xml.Name `xml:"Response"`
+	Certificate string   `xml:"Success>Data>certificate"`
+}
+
+// Certificate is a certificate installed on the LoadMaster.
+type Certificate struct {
+	Name         string
+	Intermediate bool
+
+	Subject     string
+	Issuer      string
+	DNSNames    []string
+	IPAddresses []string
+	NotBefore   time.Time
+	NotAfter    time.Time
+}
+
+// UploadCertificate installs a certificate with its private key, both PEM
+// encoded, under the given name. Intermediate certificates have to be
+// uploaded separately with UploadIntermediateCertificate.
+func (c *Client) UploadCertificate(name string, pemCert, pemKey []byte) error {
+	if err := validateCertificateName(name); err != nil {
+		return errgo.Mask(err)
+	}
+
+	certs, err := parsePEMCertificates(pemCert)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if len(certs) != 1 {
+		return errgo.Newf("certificate '%s' contains %d certificates, upload the intermediate certificates separately", name, len(certs))
+	}
+	if _, err := tls.X509KeyPair(pemCert, pemKey); err != nil {
+		return errgo.Notef(err, "invalid private key for certificate '%s'", name)
+	}
+
+	body := append(append([]byte{}, bytes.TrimSpace(pemCert)...), '\n')
+	body = append(body, pemKey...)
+
+	parameters := make(map[string]string)
+	parameters["cert"] = name
+	parameters["replace"] = "0"
+
+	return c.uploadCertificate("addcert", parameters, body)
+}
+
+// UploadIntermediateCertificate installs a PEM encoded intermediate CA
+// certificate under the given name.
+func (c *Client) UploadIntermediateCertificate(name string, pemCert []byte) error {
+	if err := validateCertificateName(name); err != nil {
+		return errgo.Mask(err)
+	}
+
+	certs, err := parsePEMCertificates(pemCert)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+	if len(certs) != 1 {
+		return errgo.Newf("intermediate certificate '%s' contains %d certificates", name, len(certs))
+	}
+
+	parameters := make(map[string]string)
+	parameters["cert"] = name
+
+	return c.uploadCertificate("addintermediate", parameters, pemCert)
+}
+
+func (c *Client) uploadCertificate(cmd string, parameters map[string]string, body []byte) error {
+	res, err := c.requestStream(context.Background(), "POST", cmd, parameters, bytes.NewReader(body))
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to upload certificate '%s'", parameters["cert"]), errgo.Any)
+	}
+	defer res.Body.Close()
+
+	data := CertificateResponse{}
+	if err := c.parseSuccess(res.Body, &data); err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	return nil
+}
+
+// ListCertificates returns the installed certificates with the details parsed
+// from each certificate.
+func (c *Client) ListCertificates() ([]Certificate, error) {
+	return c.listCertificates("listcert", "readcert", false)
+}
+
+// ListIntermediateCertificates returns the installed intermediate CA
+// certificates.
+func (c *Client) ListIntermediateCertificates() ([]Certificate, error) {
+	return c.listCertificates("listintermediate", "readintermediate", true)
+}
+
+// ShowCertificate returns the certificate with the given name.
+func (c *Client) ShowCertificate(name string) (Certificate, error) {
+	return c.readCertificate("readcert", name, false)
+}
+
+func (c *Client) listCertificates(listCmd, readCmd string, intermediate bool) ([]Certificate, error) {
+	data := CertificateListResponse{}
+	err := c.Request(listCmd, make(map[string]string), &data)
+	if err != nil {
+		return nil, errgo.NoteMask(err, "kemp unable to list certificates", errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	certificates := []Certificate{}
+	for _, cert := range data.Data.Certificates {
+		certificate, err := c.readCertificate(readCmd, cert.Name, intermediate)
+		if err != nil {
+			return nil, errgo.Mask(err, errgo.Any)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return certificates, nil
+}
+
+func (c *Client) readCertificate(cmd, name string, intermediate bool) (Certificate, error) {
+	parameters := make(map[string]string)
+	parameters["cert"] = name
+
+	data := CertificateReadResponse{}
+	err := c.Request(cmd, parameters, &data)
+	if err != nil {
+		return Certificate{}, errgo.NoteMask(err, fmt.Sprintf("kemp unable to read certificate '%s'", name), errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	cert, err := decodeCertificate(data.Certificate)
+	if err != nil {
+		return Certificate{}, errgo.Notef(err, "kemp returned invalid certificate '%s'", name)
+	}
+
+	certificate := Certificate{
+		Name:         name,
+		Intermediate: intermediate,
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		DNSNames:     cert.DNSNames,
+		IPAddresses:  []string{},
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+	for _, ip := range cert.IPAddresses {
+		certificate.IPAddresses = append(certificate.IPAddresses, ip.String())
+	}
+
+	return certificate, nil
+}
+
+// DeleteCertificate deletes the certificate with the given name. It fails if
+// a virtual service still uses it.
+func (c *Client) DeleteCertificate(name string) error {
+	return c.deleteCertificate("delcert", name)
+}
+
+// DeleteIntermediateCertificate deletes the intermediate CA certificate with
+// the given name.
+func (c *Client) DeleteIntermediateCertificate(name string) error {
+	return c.deleteCertificate("delintermediate", name)
+}
+
+func (c *Client) deleteCertificate(cmd, name string) error {
+	parameters := make(map[string]string)
+	parameters["cert"] = name
+
+	data := CertificateResponse{}
+	err := c.Request(cmd, parameters, &data)
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to delete certificate '%s'", name), errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	return nil
+}
+
+func validateCertificateName(name string) error {
+	if name == "" || len(name) > maxCertificateNameLength {
+		return errgo.Newf("certificate name '%s' must have 1 to %d characters", name, maxCertificateNameLength)
+	}
+	for _, r := range name {
+		if !isAlphanumericRune(r) && r != '.' && r != '-' && r != '_' {
+			return errgo.Newf("certificate name '%s' contains invalid character '%c'", name, r)
+		}
+	}
+
+	return nil
+}
+
+func parsePEMCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errgo.Notef(err, "invalid certificate")
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errgo.New("no PEM encoded certificate found")
+	}
+
+	return certs, nil
+}
+
+// decodeCertificate parses the first certificate of a PEM document, or a
+// base64 encoded DER certificate.
+func decodeCertificate(data string) (*x509.Certificate, error) {
+	if strings.Contains(data, "-----BEGIN") {
+		certs, err := parsePEMCertificates([]byte(data))
+		if err != nil {
+			return nil, errgo.Mask(err)
+		}
+		return certs[0], nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+	if err != nil {
+		return nil, errgo.Notef(err, "certificate is neither PEM nor base64 encoded")
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, errgo.Notef(err, "invalid certificate")
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,56 @@
+// kemp-exporter exposes the statistics of a Kemp LoadMaster as Prometheus
+// metrics.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	kempclient "github.com/giantswarm/kemp-client"
+	"github.com/giantswarm/kemp-client/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+	var (
+		listenAddress = flag.String("listen-address", ":9544", "address to expose the metrics on")
+		metricsPath   = flag.String("metrics-path", "/metrics", "path to expose the metrics on")
+		endpoint      = flag.String("endpoint", "", "API endpoint of the LoadMaster, e.g. https://loadmaster/access/")
+		user          = flag.String("user", "", "API user")
+		debug         = flag.Bool("debug", false, "print API responses")
+		certificates  = flag.Bool("certificates", false, "expose the expiry of the certificates")
+		expiryWarning = flag.Duration("certificate-expiry-warning", kempclient.DefaultCertificateExpiryWarning, "flag certificates expiring within this duration")
+		certRefresh   = flag.Duration("certificate-refresh", time.Hour, "read the certificates again after this duration")
+	)
+	flag.Parse()
+
+	if *endpoint == "" {
+		fmt.Fprintln(os.Stderr, "-endpoint is required")
+		os.Exit(2)
+	}
+
+	client := kempclient.NewClient(kempclient.Config{
+		User: *user,
+		// The password is read from the environment to keep it out of the
+		// process list.
+		Password: os.Getenv("KEMP_PASSWORD"),
+		Endpoint: *endpoint,
+		Debug:    *debug,
+	})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector.New(client))
+	if *certificates {
+		registry.MustRegister(collector.NewCertificateCollector(client, *expiryWarning, *certRefresh))
+	}
+
+	http.Handle(*metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	log.Printf("listening on %s", *listenAddress)
+	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+}
@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	kempclient "github.com/giantswarm/kemp-client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var certificateLabels = []string{"name", "subject", "intermediate"}
+
+// CertificateCollector implements prometheus.Collector for the expiry and the
+// usage of the certificates. Reading all certificates takes a request per
+// certificate, so the report is reused between scrapes and the collector is
+// kept separate from Collector.
+type CertificateCollector struct {
+	client  *kempclient.Client
+	warning time.Duration
+	refresh time.Duration
+
+	mutex    sync.Mutex
+	report   kempclient.CertificateReport
+	readTime time.Time
+
+	up *prometheus.Desc
+
+	expiry          *prometheus.Desc
+	daysToExpiry    *prometheus.Desc
+	virtualServices *prometheus.Desc
+	expiringSoon    *prometheus.Desc
+	expired         *prometheus.Desc
+}
+
+// NewCertificateCollector returns a collector flagging certificates expiring
+// within warning, see kempclient.NewCertificateReport. The certificates are
+// read again once the report is older than refresh, 0 reads them on every
+// scrape.
+func NewCertificateCollector(client *kempclient.Client, warning, refresh time.Duration) *CertificateCollector {
+	cert := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "certificate", name), help, certificateLabels, nil)
+	}
+
+	return &CertificateCollector{
+		client:  client,
+		warning: warning,
+		refresh: refresh,
+
+		up: prometheus.NewDesc(prometheus.BuildFQName(namespace, "certificates", "up"), "Whether the LoadMaster certificates could be read.", nil, nil),
+
+		expiry:          cert("expiry_timestamp_seconds", "Time the certificate expires as unix timestamp."),
+		daysToExpiry:    cert("days_to_expiry", "Days until the certificate expires, negative once expired."),
+		virtualServices: cert("virtual_services", "Number of virtual services serving the certificate."),
+		expiringSoon:    cert("expiring_soon", "Whether the certificate expires soon."),
+		expired:         cert("expired", "Whether the certificate expired."),
+	}
+}
+
+func (c *CertificateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{c.up, c.expiry, c.daysToExpiry, c.virtualServices, c.expiringSoon, c.expired} {
+		ch <- desc
+	}
+}
+
+func (c *CertificateCollector) Collect(ch chan<- prometheus.Metric) {
+	report, err := c.currentReport()
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+
+	for _, cert := range report.Certificates {
+		labels := []string{cert.Name, cert.Subject, strconv.FormatBool(cert.Intermediate)}
+
+		ch <- prometheus.MustNewConstMetric(c.expiry, prometheus.GaugeValue, float64(cert.NotAfter.Unix()), labels...)
+		ch <- prometheus.MustNewConstMetric(c.daysToExpiry, prometheus.GaugeValue, float64(cert.DaysToExpiry), labels...)
+		ch <- prometheus.MustNewConstMetric(c.virtualServices, prometheus.GaugeValue, float64(len(cert.VirtualServices)), labels...)
+		ch <- prometheus.MustNewConstMetric(c.expiringSoon, prometheus.GaugeValue, boolValue(cert.ExpiringSoon), labels...)
+		ch <- prometheus.MustNewConstMetric(c.expired, prometheus.GaugeValue, boolValue(cert.Expired), labels...)
+	}
+}
+
+// currentReport returns the last report unless it is older than refresh.
+// Failed reads are not kept, so the next scrape tries again.
+func (c *CertificateCollector) currentReport() (kempclient.CertificateReport, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.readTime.IsZero() && time.Since(c.readTime) < c.refresh {
+		return c.report, nil
+	}
+
+	report, err := c.client.CertificateReport(c.warning)
+	if err != nil {
+		return kempclient.CertificateReport{}, err
+	}
+	c.report, c.readTime = report, time.Now()
+
+	return report, nil
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
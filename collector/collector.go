@@ -0,0 +1,141 @@
+// Package collector exposes the statistics of a Kemp LoadMaster as Prometheus
+// metrics.
+package collector
+
+import (
+	"strconv"
+
+	kempclient "github.com/giantswarm/kemp-client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "kemp"
+
+var (
+	virtualServiceLabels = []string{"address", "port", "protocol", "nickname"}
+	realServerLabels     = []string{"vs_address", "vs_port", "vs_protocol", "vs_nickname", "address", "port"}
+)
+
+// Collector implements prometheus.Collector. Every scrape calls GetStatistics
+// and ListVirtualServices, the latter to label the metrics with the nickname of
+// the virtual service.
+type Collector struct {
+	client *kempclient.Client
+
+	up *prometheus.Desc
+
+	vsConnections       *prometheus.Desc
+	vsActiveConnections *prometheus.Desc
+	vsBytes             *prometheus.Desc
+	vsBytesRead         *prometheus.Desc
+	vsBytesWritten      *prometheus.Desc
+	vsPackets           *prometheus.Desc
+	vsEnabled           *prometheus.Desc
+
+	rsConnections       *prometheus.Desc
+	rsActiveConnections *prometheus.Desc
+	rsBytes             *prometheus.Desc
+	rsBytesRead         *prometheus.Desc
+	rsBytesWritten      *prometheus.Desc
+	rsPackets           *prometheus.Desc
+	rsEnabled           *prometheus.Desc
+	rsWeight            *prometheus.Desc
+}
+
+func New(client *kempclient.Client) *Collector {
+	vs := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "virtual_service", name), help, virtualServiceLabels, nil)
+	}
+	rs := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "real_server", name), help, realServerLabels, nil)
+	}
+
+	return &Collector{
+		client: client,
+
+		up: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "up"), "Whether the LoadMaster statistics could be read.", nil, nil),
+
+		vsConnections:       vs("connections_total", "Total number of connections of the virtual service."),
+		vsActiveConnections: vs("active_connections", "Number of active connections of the virtual service."),
+		vsBytes:             vs("bytes_total", "Total number of bytes of the virtual service."),
+		vsBytesRead:         vs("bytes_read_total", "Total number of bytes read by the virtual service."),
+		vsBytesWritten:      vs("bytes_written_total", "Total number of bytes written by the virtual service."),
+		vsPackets:           vs("packets_total", "Total number of packets of the virtual service."),
+		vsEnabled:           vs("enabled", "Whether the virtual service is enabled."),
+
+		rsConnections:       rs("connections_total", "Total number of connections of the real server."),
+		rsActiveConnections: rs("active_connections", "Number of active connections of the real server."),
+		rsBytes:             rs("bytes_total", "Total number of bytes of the real server."),
+		rsBytesRead:         rs("bytes_read_total", "Total number of bytes read by the real server."),
+		rsBytesWritten:      rs("bytes_written_total", "Total number of bytes written by the real server."),
+		rsPackets:           rs("packets_total", "Total number of packets of the real server."),
+		rsEnabled:           rs("enabled", "Whether the real server is enabled."),
+		rsWeight:            rs("weight", "Weight of the real server."),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		c.up,
+		c.vsConnections, c.vsActiveConnections, c.vsBytes, c.vsBytesRead, c.vsBytesWritten, c.vsPackets, c.vsEnabled,
+		c.rsConnections, c.rsActiveConnections, c.rsBytes, c.rsBytesRead, c.rsBytesWritten, c.rsPackets, c.rsEnabled, c.rsWeight,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.client.GetStatistics()
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+
+	// The nickname is only a label, missing it is not worth failing the scrape.
+	list, _ := c.client.ListVirtualServices()
+
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+
+	for _, joined := range stats.Join(list) {
+		vs := joined.Stats
+
+		// Real servers of a virtual service without statistics cannot be
+		// labeled uniquely, so they are skipped.
+		if vs.Address == "" {
+			continue
+		}
+
+		vsLabels := []string{vs.Address, strconv.Itoa(vs.Port), vs.Protocol, joined.Nickname}
+
+		sendValid(ch, vs.Valid("TotalConnections"), c.vsConnections, prometheus.CounterValue, float64(vs.TotalConnections), vsLabels...)
+		sendValid(ch, vs.Valid("ActiveConnections"), c.vsActiveConnections, prometheus.GaugeValue, float64(vs.ActiveConnections), vsLabels...)
+		sendValid(ch, vs.Valid("TotalBytes"), c.vsBytes, prometheus.CounterValue, float64(vs.TotalBytes), vsLabels...)
+		sendValid(ch, vs.Valid("BytesRead"), c.vsBytesRead, prometheus.CounterValue, float64(vs.BytesRead), vsLabels...)
+		sendValid(ch, vs.Valid("BytesWritten"), c.vsBytesWritten, prometheus.CounterValue, float64(vs.BytesWritten), vsLabels...)
+		sendValid(ch, vs.Valid("TotalPackets"), c.vsPackets, prometheus.CounterValue, float64(vs.TotalPackets), vsLabels...)
+		sendValid(ch, vs.Valid("Enabled"), c.vsEnabled, prometheus.GaugeValue, float64(vs.Enabled), vsLabels...)
+
+		for _, rs := range joined.RealServers {
+			labels := append(append([]string{}, vsLabels...), rs.Address, strconv.Itoa(rs.Port))
+
+			sendValid(ch, rs.Valid("TotalConnections"), c.rsConnections, prometheus.CounterValue, float64(rs.TotalConnections), labels...)
+			sendValid(ch, rs.Valid("ActiveConnections"), c.rsActiveConnections, prometheus.GaugeValue, float64(rs.ActiveConnections), labels...)
+			sendValid(ch, rs.Valid("TotalBytes"), c.rsBytes, prometheus.CounterValue, float64(rs.TotalBytes), labels...)
+			sendValid(ch, rs.Valid("BytesRead"), c.rsBytesRead, prometheus.CounterValue, float64(rs.BytesRead), labels...)
+			sendValid(ch, rs.Valid("BytesWritten"), c.rsBytesWritten, prometheus.CounterValue, float64(rs.BytesWritten), labels...)
+			sendValid(ch, rs.Valid("TotalPackets"), c.rsPackets, prometheus.CounterValue, float64(rs.TotalPackets), labels...)
+			sendValid(ch, rs.Valid("Enabled"), c.rsEnabled, prometheus.GaugeValue, float64(rs.Enabled), labels...)
+			sendValid(ch, rs.Valid("Weight"), c.rsWeight, prometheus.GaugeValue, float64(rs.Weight), labels...)
+		}
+	}
+}
+
+// sendValid sends the metric unless its value could not be parsed, as
+// Prometheus would treat the zero value of a counter as a reset.
+func sendValid(ch chan<- prometheus.Metric, valid bool, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) {
+	if !valid {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(desc, valueType, value, labels...)
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kempclient "github.com/giantswarm/kemp-client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectorSkipsRealServersWithoutVirtualServiceStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "stats":
+			fmt.Fprint(w, `<Response stat="200" code="ok"><Success><Data>`+
+				`<Vs><Index>1</Index><VSAddress>10.0.0.1</VSAddress><VSPort>80</VSPort><VSProt>tcp</VSProt></Vs>`+
+				`<Rs><VSIndex>1</VSIndex><RSIndex>1</RSIndex><Addr>10.0.1.1</Addr><Port>8080</Port></Rs>`+
+				`<Rs><VSIndex>2</VSIndex><RSIndex>2</RSIndex><Addr>10.0.1.1</Addr><Port>8080</Port></Rs>`+
+				`<Rs><VSIndex>3</VSIndex><RSIndex>3</RSIndex><Addr>10.0.1.1</Addr><Port>8080</Port></Rs>`+
+				`</Data></Success></Response>`)
+		default:
+			fmt.Fprint(w, `<Response stat="200" code="ok"><Success><Data></Data></Success></Response>`)
+		}
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(New(kempclient.NewClient(kempclient.Config{Endpoint: server.URL + "/"})))
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() == "kemp_real_server_connections_total" {
+			if len(family.GetMetric()) != 1 {
+				t.Errorf("expected only the real server of virtual service 1, got %v", family.GetMetric())
+			}
+			return
+		}
+	}
+	t.Errorf("expected real server metrics, got %v", families)
+}
@@ -3,20 +3,55 @@ package kempclient
 import (
 	"encoding/xml"
 	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
 
 	"github.com/juju/errgo"
 )
 
 // Information about the content rules can be found in https://support.kemptechnologies.com/hc/en-us/articles/203863435-RESTful-API
 
+// These are the types of a content rule.
 const (
+	ContentRuleMatchContent = "0"
 	ContentRuleAddHeader    = "1"
-	ContentRuleUpdateHeader = "3"
 	ContentRuleDeleteHeader = "2"
-	DeleteHeaderProtoName   = "DeleteHeaderProto"
-	DeleteHeaderPortName    = "DeleteHeaderPort"
-	DeleteHeaderPortValue   = "X-Forwarded-Port"
-	DeleteHeaderProtoValue  = "X-Forwarded-Proto"
+	ContentRuleUpdateHeader = "3"
+	ContentRuleModifyURL    = "4"
+	ContentRuleReplaceBody  = "5"
+)
+
+// These are the options for the MatchType field of a content matching rule.
+const (
+	ContentRuleMatchRegex   = "regex"
+	ContentRuleMatchPrefix  = "prefix"
+	ContentRuleMatchPostfix = "postfix"
+)
+
+// HeaderContentRulePrefix is the prefix of all content rules created for the
+// Headers of a virtual service. Rules with this prefix are owned by this client
+// and are removed by GarbageCollectContentRules once no virtual service uses
+// them anymore.
+const HeaderContentRulePrefix = "kchdr"
+
+// maxContentRuleNameLength is the maximum length of names generated by
+// HeaderContentRuleName.
+const maxContentRuleNameLength = 32
+
+const (
+	DeleteHeaderProtoName  = "DeleteHeaderProto"
+	DeleteHeaderPortName   = "DeleteHeaderPort"
+	DeleteHeaderPortValue  = "X-Forwarded-Port"
+	DeleteHeaderProtoValue = "X-Forwarded-Proto"
+)
+
+// These are the stages in which a virtual service references a content rule.
+const (
+	ContentRuleStageMatch      = "match"
+	ContentRuleStageRequest    = "request"
+	ContentRuleStageResponse   = "response"
+	ContentRuleStagePreProcess = "preprocess"
 )
 
 type ContentRuleResponse struct {
@@ -25,56 +60,365 @@ type ContentRuleResponse struct {
 	CR      ContentRule `xml:"Success>Data"`
 }
 
+type ContentRuleListResponse struct {
+	Debug   string          `xml:",innerxml"`
+	XMLName xml.Name        `xml:"Response"`
+	Data    ContentRuleList `xml:"Success>Data"`
+}
+
+// ContentRuleList is the raw list returned by `showrule`. The element name of
+// every entry denotes the type of the rule.
+type ContentRuleList struct {
+	Rules []ContentRuleData `xml:",any"`
+}
+
+type ContentRuleData struct {
+	XMLName         xml.Name `xml:""`
+	Name            string
+	Pattern         string
+	MatchType       string
+	Header          string
+	HeaderValue     string
+	Replacement     string
+	AddHost         string
+	IncludeQuery    string
+	CaseIndependent string
+	Negate          string
+	MustFail        string
+	SetFlagOnMatch  string
+	OnlyOnFlag      string
+	OnlyOnNoFlag    string
+}
+
+// ContentRuleReference is a virtual service using a content rule.
+type ContentRuleReference struct {
+	VirtualService int
+	Stage          string
+}
+
+// ContentRule describes a content rule of any type. Which fields are used
+// depends on the type, see the New*Rule functions.
 type ContentRule struct {
-	Name        string `xml:"Name"`
-	Header      string `xml:"Header"`
+	// Name of the rule. The LoadMaster only accepts alphanumeric names.
+	Name string `xml:"Name"`
+	Type string `xml:"-"`
+
+	// Pattern is matched against the URL, or the value of Header if set.
+	// For delete header rules it is the name of the header to delete.
+	Pattern   string `xml:"Pattern"`
+	MatchType string `xml:"MatchType"`
+	Header    string `xml:"Header"`
+
+	// Replacement is the new value of the header, URL or response body.
+	Replacement string `xml:"Replacement"`
+
+	// HeaderValue is the value of an add header rule.
+	//
+	// Deprecated: Use Replacement. HeaderValue is only used if Replacement is
+	// empty.
 	HeaderValue string `xml:"HeaderValue"`
+
+	NoCase       bool `xml:"-"`
+	Negate       bool `xml:"-"`
+	IncludeHost  bool `xml:"-"`
+	IncludeQuery bool `xml:"-"`
+	MustFail     bool `xml:"-"`
+
+	// The flags range from 1 to 9, 0 means unset.
+	SetFlagOnMatch int `xml:"-"`
+	OnlyOnFlag     int `xml:"-"`
+	OnlyOnNoFlag   int `xml:"-"`
+
+	// References is only filled by ListContentRules and ShowContentRule.
+	References []ContentRuleReference `xml:"-"`
 }
 
-func (c *Client) AddHeaderContentRule(name, headerKey, headerValue string) error {
+// NewMatchContentRule returns a content matching rule. Use the fields of the
+// returned rule to match case-insensitive, negate the match, include the host
+// or query in the URL or to match on a header instead of the URL.
+func NewMatchContentRule(name, pattern, matchType string) ContentRule {
+	return ContentRule{
+		Name:      name,
+		Type:      ContentRuleMatchContent,
+		Pattern:   pattern,
+		MatchType: matchType,
+	}
+}
+
+// NewAddHeaderRule returns a rule adding the header with the given value.
+func NewAddHeaderRule(name, header, value string) ContentRule {
+	return ContentRule{
+		Name:        name,
+		Type:        ContentRuleAddHeader,
+		Header:      header,
+		Replacement: value,
+	}
+}
+
+// NewDeleteHeaderRule returns a rule deleting all headers matching pattern.
+func NewDeleteHeaderRule(name, pattern string) ContentRule {
+	return ContentRule{
+		Name:    name,
+		Type:    ContentRuleDeleteHeader,
+		Pattern: pattern,
+	}
+}
+
+// NewUpdateHeaderRule returns a rule replacing pattern in the value of the
+// header.
+func NewUpdateHeaderRule(name, header, pattern, replacement string) ContentRule {
+	return ContentRule{
+		Name:        name,
+		Type:        ContentRuleUpdateHeader,
+		Header:      header,
+		Pattern:     pattern,
+		Replacement: replacement,
+	}
+}
+
+// NewModifyURLRule returns a rule replacing pattern in the URL.
+func NewModifyURLRule(name, pattern, replacement string) ContentRule {
+	return ContentRule{
+		Name:        name,
+		Type:        ContentRuleModifyURL,
+		Pattern:     pattern,
+		Replacement: replacement,
+	}
+}
+
+// NewReplaceURLRule returns a rule replacing the whole URL.
+func NewReplaceURLRule(name, url string) ContentRule {
+	return NewModifyURLRule(name, "/^.*$/", url)
+}
+
+// NewReplaceBodyRule returns a rule replacing pattern in the response body.
+func NewReplaceBodyRule(name, pattern, replacement string) ContentRule {
+	return ContentRule{
+		Name:        name,
+		Type:        ContentRuleReplaceBody,
+		Pattern:     pattern,
+		Replacement: replacement,
+	}
+}
+
+func (c *Client) AddContentRule(rule ContentRule) error {
+	ruleParameters, err := contentRuleParameters(rule)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
 	data := ContentRuleResponse{}
+	err = c.Request("addrule", ruleParameters, &data)
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to add content rule %s '%#v'", rule.Name, ruleParameters), errgo.Any)
+	}
 
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	return nil
+}
+
+func (c *Client) ModifyContentRule(rule ContentRule) error {
+	ruleParameters, err := contentRuleParameters(rule)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	data := ContentRuleResponse{}
+	err = c.Request("modrule", ruleParameters, &data)
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to update content rule %s '%#v'", rule.Name, ruleParameters), errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	return nil
+}
+
+func (c *Client) DeleteContentRule(name string) error {
 	ruleParameters := make(map[string]string)
-	// Only accepts alphanumeric names
 	ruleParameters["name"] = name
-	// Add Header to HTTP Request
-	ruleParameters["type"] = ContentRuleAddHeader
-	ruleParameters["header"] = headerKey
-	ruleParameters["replacement"] = headerValue
 
-	err := c.Request("addrule", ruleParameters, &data)
+	data := ContentRuleResponse{}
+	err := c.Request("delrule", ruleParameters, &data)
 	if err != nil {
-		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to add content rule %s with header %s and value %s for virtual service %s '%#v'", name, headerKey, headerValue, ruleParameters), errgo.Any)
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to delete content rule %s", name), errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
 	}
 
 	return nil
 }
 
-func (c *Client) AddProtoPortHeaderRequestRules() error {
-	data := ContentRuleResponse{}
+// ListContentRules returns all content rules together with the virtual
+// services referencing them.
+func (c *Client) ListContentRules() ([]ContentRule, error) {
+	rules, err := c.showContentRules(make(map[string]string))
+	if err != nil {
+		return []ContentRule{}, errgo.Mask(err)
+	}
+
+	err = c.addContentRuleReferences(rules)
+	if err != nil {
+		return []ContentRule{}, errgo.Mask(err)
+	}
+
+	return rules, nil
+}
+
+// ShowContentRule returns the content rule together with the virtual services
+// referencing it.
+func (c *Client) ShowContentRule(name string) (ContentRule, error) {
 	ruleParameters := make(map[string]string)
+	ruleParameters["name"] = name
+
+	rules, err := c.showContentRules(ruleParameters)
+	if err != nil {
+		return ContentRule{}, errgo.Mask(err)
+	}
+	if len(rules) != 1 {
+		return ContentRule{}, errgo.Newf("kemp returned %d content rules for %s", len(rules), name)
+	}
+
+	err = c.addContentRuleReferences(rules)
+	if err != nil {
+		return ContentRule{}, errgo.Mask(err)
+	}
 
-	ruleParameters["name"] = DeleteHeaderProtoName
-	ruleParameters["type"] = ContentRuleDeleteHeader
+	return rules[0], nil
+}
+
+func (c *Client) showContentRules(ruleParameters map[string]string) ([]ContentRule, error) {
+	data := ContentRuleListResponse{}
+	err := c.Request("showrule", ruleParameters, &data)
+	if err != nil {
+		return []ContentRule{}, errgo.NoteMask(err, fmt.Sprintf("kemp unable to show content rules '%#v'", ruleParameters), errgo.Any)
+	}
 
-	if err := c.Request("showrule", ruleParameters, &data); err != nil {
-		// The Rule doesn't exists
-		ruleParameters["pattern"] = DeleteHeaderProtoValue
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
 
-		err := c.Request("addrule", ruleParameters, &data)
-		if err != nil {
-			return errgo.NoteMask(err, fmt.Sprintf("kemp unable to add content rule %s with value %s for virtual service %s '%#v'", DeleteHeaderProtoName, DeleteHeaderProtoValue, ruleParameters), errgo.Any)
+	rules := []ContentRule{}
+	for _, d := range data.Data.Rules {
+		rules = append(rules, d.contentRule())
+	}
+
+	return rules, nil
+}
+
+func (c *Client) addContentRuleReferences(rules []ContentRule) error {
+	list, err := c.ListVirtualServices()
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	references := make(map[string][]ContentRuleReference)
+	for _, vs := range list {
+		for stage, names := range map[string][]string{
+			ContentRuleStageMatch:      vs.MatchRules,
+			ContentRuleStageRequest:    vs.RequestRules,
+			ContentRuleStageResponse:   vs.ResponseRules,
+			ContentRuleStagePreProcess: vs.PreProcessRules,
+		} {
+			for _, name := range names {
+				references[name] = append(references[name], ContentRuleReference{
+					VirtualService: vs.ID,
+					Stage:          stage,
+				})
+			}
 		}
 	}
 
-	ruleParameters["name"] = DeleteHeaderPortName
+	for i := range rules {
+		rules[i].References = references[rules[i].Name]
+	}
+
+	return nil
+}
+
+func (d ContentRuleData) contentRule() ContentRule {
+	rule := ContentRule{
+		Name:         d.Name,
+		Pattern:      d.Pattern,
+		MatchType:    strings.ToLower(d.MatchType),
+		Header:       d.Header,
+		Replacement:  d.Replacement,
+		NoCase:       d.CaseIndependent == "Y",
+		Negate:       d.Negate == "Y",
+		IncludeHost:  d.AddHost == "Y",
+		IncludeQuery: d.IncludeQuery == "Y",
+		MustFail:     d.MustFail == "Y",
+	}
+
+	// The flags are empty or 0 when unset.
+	rule.SetFlagOnMatch, _ = strconv.Atoi(d.SetFlagOnMatch)
+	rule.OnlyOnFlag, _ = strconv.Atoi(d.OnlyOnFlag)
+	rule.OnlyOnNoFlag, _ = strconv.Atoi(d.OnlyOnNoFlag)
+
+	switch d.XMLName.Local {
+	case "MatchContentRule":
+		rule.Type = ContentRuleMatchContent
+	case "AddHeaderRule":
+		rule.Type = ContentRuleAddHeader
+		rule.Replacement = d.HeaderValue
+	case "DeleteHeaderRule":
+		rule.Type = ContentRuleDeleteHeader
+	case "ReplaceHeaderRule":
+		rule.Type = ContentRuleUpdateHeader
+	case "ModifyURLRule":
+		rule.Type = ContentRuleModifyURL
+	case "ReplaceBodyRule":
+		rule.Type = ContentRuleReplaceBody
+	}
+
+	return rule
+}
+
+func (c *Client) AddHeaderContentRule(name, headerKey, headerValue string) error {
+	err := c.AddContentRule(NewAddHeaderRule(name, headerKey, headerValue))
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to add content rule %s with header %s and value %s", name, headerKey, headerValue), errgo.Any)
+	}
+
+	return nil
+}
+
+// AddProtoPortHeaderRequestRules adds the rules deleting the X-Forwarded-Proto
+// and X-Forwarded-Port headers unless they exist already. The rules are shared
+// by all virtual services, calls of the same client are serialized so that
+// concurrent AddVirtualService calls don't add them more than once.
+func (c *Client) AddProtoPortHeaderRequestRules() error {
+	c.protoPortRulesMutex.Lock()
+	defer c.protoPortRulesMutex.Unlock()
+
+	rules, err := c.showContentRules(make(map[string]string))
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	existing := make(map[string]bool)
+	for _, rule := range rules {
+		existing[rule.Name] = true
+	}
 
-	if err := c.Request("showrule", ruleParameters, &data); err != nil {
-		ruleParameters["pattern"] = DeleteHeaderPortValue
+	if !existing[DeleteHeaderProtoName] {
+		err := c.AddContentRule(NewDeleteHeaderRule(DeleteHeaderProtoName, DeleteHeaderProtoValue))
+		if err != nil {
+			return errgo.NoteMask(err, fmt.Sprintf("kemp unable to add content rule %s with value %s", DeleteHeaderProtoName, DeleteHeaderProtoValue), errgo.Any)
+		}
+	}
 
-		err = c.Request("addrule", ruleParameters, &data)
+	if !existing[DeleteHeaderPortName] {
+		err := c.AddContentRule(NewDeleteHeaderRule(DeleteHeaderPortName, DeleteHeaderPortValue))
 		if err != nil {
-			return errgo.NoteMask(err, fmt.Sprintf("kemp unable to add content rule %s with value %s for virtual service %s '%#v'", DeleteHeaderPortName, DeleteHeaderPortValue, ruleParameters), errgo.Any)
+			return errgo.NoteMask(err, fmt.Sprintf("kemp unable to add content rule %s with value %s", DeleteHeaderPortName, DeleteHeaderPortValue), errgo.Any)
 		}
 	}
 
@@ -82,36 +426,186 @@ func (c *Client) AddProtoPortHeaderRequestRules() error {
 }
 
 func (c *Client) UpdateHeaderContentRule(name, headerKey, headerValue string) error {
-	data := ContentRuleResponse{}
+	err := c.ModifyContentRule(NewUpdateHeaderRule(name, headerKey, "", headerValue))
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to update content rule %s with header %s and value %s", name, headerKey, headerValue), errgo.Any)
+	}
 
-	ruleParameters := make(map[string]string)
-	// Only accepts alphanumeric names
-	ruleParameters["name"] = name
-	// Update Header to HTTP Request
-	ruleParameters["type"] = ContentRuleUpdateHeader
-	ruleParameters["header"] = headerKey
-	ruleParameters["replacement"] = headerValue
+	return nil
+}
 
-	err := c.Request("modrule", ruleParameters, &data)
+func (c *Client) DeleteHeaderContentRule(name string) error {
+	err := c.DeleteContentRule(name)
 	if err != nil {
-		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to update content rule %s with header %s and value %s for virtual service %s '%#v'", name, headerKey, headerValue, ruleParameters), errgo.Any)
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to delete content rule %s header", name), errgo.Any)
 	}
 
 	return nil
 }
 
-func (c *Client) DeleteHeaderContentRule(name string) error {
-	data := ContentRuleResponse{}
+func contentRuleParameters(rule ContentRule) (map[string]string, error) {
+	if rule.Name == "" {
+		return nil, errgo.New("A content rule needs a name")
+	}
+	if sanitizeContentRuleName(rule.Name) != rule.Name {
+		return nil, errgo.Newf("%s is not a valid content rule name, only alphanumeric characters are allowed", rule.Name)
+	}
 
 	ruleParameters := make(map[string]string)
 	// Only accepts alphanumeric names
-	ruleParameters["name"] = name
-	// Delete Header to HTTP Request
-	ruleParameters["type"] = ContentRuleDeleteHeader
+	ruleParameters["name"] = rule.Name
+	ruleParameters["type"] = rule.Type
 
-	err := c.Request("delrule", ruleParameters, &data)
-	if err != nil {
-		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to delete  content rule %s header for virtual service '%#v'", name, ruleParameters), errgo.Any)
+	switch rule.Type {
+	case ContentRuleMatchContent:
+		if rule.MatchType != "" {
+			ruleParameters["matchtype"] = rule.MatchType
+		}
+		if rule.Header != "" {
+			ruleParameters["header"] = rule.Header
+		}
+		ruleParameters["nocase"] = yesNo(rule.NoCase)
+		ruleParameters["negate"] = yesNo(rule.Negate)
+		ruleParameters["inchost"] = yesNo(rule.IncludeHost)
+		ruleParameters["incquery"] = yesNo(rule.IncludeQuery)
+		ruleParameters["mustfail"] = yesNo(rule.MustFail)
+	case ContentRuleAddHeader:
+		if rule.Header == "" {
+			return nil, errgo.Newf("The add header rule %s needs a header", rule.Name)
+		}
+		ruleParameters["header"] = rule.Header
+	case ContentRuleUpdateHeader:
+		if rule.Header == "" {
+			return nil, errgo.Newf("The update header rule %s needs a header", rule.Name)
+		}
+		ruleParameters["header"] = rule.Header
+	case ContentRuleDeleteHeader, ContentRuleModifyURL, ContentRuleReplaceBody:
+		if rule.Pattern == "" {
+			return nil, errgo.Newf("The content rule %s needs a pattern", rule.Name)
+		}
+	default:
+		return nil, errgo.Newf("%s is not a valid content rule type", rule.Type)
 	}
+
+	if rule.Pattern != "" {
+		ruleParameters["pattern"] = rule.Pattern
+	}
+	if rule.Type != ContentRuleMatchContent && rule.Type != ContentRuleDeleteHeader {
+		ruleParameters["replacement"] = rule.Replacement
+		if rule.Replacement == "" {
+			ruleParameters["replacement"] = rule.HeaderValue
+		}
+	}
+
+	for key, flag := range map[string]int{
+		"setflagonmatch": rule.SetFlagOnMatch,
+		"onlyonflag":     rule.OnlyOnFlag,
+		"onlyonnoflag":   rule.OnlyOnNoFlag,
+	} {
+		if flag < 0 || flag > 9 {
+			return nil, errgo.Newf("The %s flag of content rule %s must be between 1 and 9", key, rule.Name)
+		}
+		if flag != 0 {
+			ruleParameters[key] = strconv.Itoa(flag)
+		}
+	}
+
+	return ruleParameters, nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "Y"
+	}
+
+	return "N"
+}
+
+// HeaderContentRuleName returns the name of the content rule created for the
+// header key of the virtual service. The name consists of HeaderContentRulePrefix,
+// the alphanumeric characters of the virtual service name and the key, and a
+// hash of both so that names neither collide nor exceed the maximum length.
+func HeaderContentRuleName(vsName, key string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(vsName))
+	hash.Write([]byte{0})
+	hash.Write([]byte(key))
+	sum := fmt.Sprintf("%08x", hash.Sum32())
+
+	readable := sanitizeContentRuleName(vsName + key)
+	if max := maxContentRuleNameLength - len(HeaderContentRulePrefix) - len(sum); len(readable) > max {
+		readable = readable[:max]
+	}
+
+	return HeaderContentRulePrefix + readable + sum
+}
+
+// sanitizeContentRuleName drops all characters the LoadMaster does not accept
+// in the name of a content rule.
+func sanitizeContentRuleName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if isAlphanumericRune(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// legacyHeaderContentRuleNames are the names header rules had before
+// HeaderContentRuleName was introduced.
+func legacyHeaderContentRuleNames(vsName, key string) []string {
+	name := strings.Replace(vsName+key, "-", "", -1)
+	return []string{name, HeaderContentRulePrefix + name}
+}
+
+// deleteLegacyHeaderContentRules detaches and deletes the header rules of the
+// virtual service which still use a legacy name, so they are not applied twice
+// once the rules named by HeaderContentRuleName are attached.
+func (c *Client) deleteLegacyHeaderContentRules(current VirtualService, headers map[string]string) error {
+	names := []string{}
+	for key := range headers {
+		names = append(names, legacyHeaderContentRuleNames(current.Name, key)...)
+	}
+
+	return c.deleteAttachedContentRules(current, names)
+}
+
+// deleteRenamedHeaderContentRules detaches and deletes the header rules named
+// after the current name of the virtual service, once the rules named after
+// its new name are attached.
+func (c *Client) deleteRenamedHeaderContentRules(current VirtualService, name string, headers map[string]string) error {
+	if name == current.Name {
+		return nil
+	}
+
+	names := []string{}
+	for key := range headers {
+		names = append(names, HeaderContentRuleName(current.Name, key))
+	}
+
+	return c.deleteAttachedContentRules(current, names)
+}
+
+// deleteAttachedContentRules detaches and deletes those of the named rules
+// which are attached to the virtual service as request rules.
+func (c *Client) deleteAttachedContentRules(current VirtualService, names []string) error {
+	attached := make(map[string]bool)
+	for _, rule := range current.RequestRules {
+		attached[rule] = true
+	}
+
+	for _, name := range names {
+		if !attached[name] {
+			continue
+		}
+
+		if err := c.DeleteRequestRuleByID(current.ID, name); err != nil {
+			return errgo.Mask(err)
+		}
+		if err := c.DeleteContentRule(name); err != nil {
+			return errgo.Mask(err)
+		}
+	}
+
 	return nil
 }
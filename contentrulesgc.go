@@ -0,0 +1,113 @@
+package kempclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// ContentRuleMatcher selects content rules, e.g. additional rules which may be
+// garbage collected.
+type ContentRuleMatcher func(rule ContentRule) bool
+
+// LegacyHeaderContentRules matches the header rules created for the given
+// virtual services before HeaderContentRulePrefix was introduced. These rules
+// are named after the virtual service and the header key only, so they cannot
+// be told apart from foreign rules without knowing the virtual service names.
+func LegacyHeaderContentRules(vsNames ...string) ContentRuleMatcher {
+	return func(rule ContentRule) bool {
+		if rule.Type != ContentRuleAddHeader || rule.Header == "" {
+			return false
+		}
+
+		for _, vsName := range vsNames {
+			for _, name := range legacyHeaderContentRuleNames(vsName, rule.Header) {
+				if rule.Name == name {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+}
+
+// ContentRuleGarbageCollection reports the result of GarbageCollectContentRules.
+type ContentRuleGarbageCollection struct {
+	DryRun bool
+	// Orphans are the owned or legacy rules not referenced by any virtual service.
+	Orphans []string
+	// Deleted are the orphans which have been deleted. It is empty on a dry run.
+	Deleted []string
+	// Failed are the orphans which could not be deleted.
+	Failed map[string]error
+}
+
+// IsOwnedContentRule returns whether the content rule has been created by this
+// client and may be garbage collected.
+func IsOwnedContentRule(name string) bool {
+	return strings.HasPrefix(name, HeaderContentRulePrefix)
+}
+
+// GarbageCollectContentRules deletes all owned content rules which are not
+// referenced by any virtual service anymore, e.g. after the virtual service has
+// been deleted. On a dry run the orphans are only reported.
+//
+// Rules matched by one of the legacy matchers are collected as well, e.g. use
+// LegacyHeaderContentRules to collect the header rules of deleted virtual
+// services which have been created before HeaderContentRulePrefix was
+// introduced.
+func (c *Client) GarbageCollectContentRules(dryRun bool, legacy ...ContentRuleMatcher) (ContentRuleGarbageCollection, error) {
+	result := ContentRuleGarbageCollection{
+		DryRun: dryRun,
+		Failed: make(map[string]error),
+	}
+
+	rules, err := c.ListContentRules()
+	if err != nil {
+		return result, errgo.Mask(err)
+	}
+
+	for _, rule := range rules {
+		if len(rule.References) == 0 && isCollectableContentRule(rule, legacy) {
+			result.Orphans = append(result.Orphans, rule.Name)
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	for _, name := range result.Orphans {
+		if err := c.DeleteContentRule(name); err != nil {
+			result.Failed[name] = err
+			continue
+		}
+		result.Deleted = append(result.Deleted, name)
+	}
+
+	if len(result.Failed) > 0 {
+		return result, errgo.Newf("kemp unable to delete %d of %d orphaned content rules", len(result.Failed), len(result.Orphans))
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG: garbage collected content rules", result.Deleted)
+	}
+
+	return result, nil
+}
+
+func isCollectableContentRule(rule ContentRule, legacy []ContentRuleMatcher) bool {
+	if IsOwnedContentRule(rule.Name) {
+		return true
+	}
+
+	for _, matches := range legacy {
+		if matches(rule) {
+			return true
+		}
+	}
+
+	return false
+}
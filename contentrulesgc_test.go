@@ -0,0 +1,100 @@
+package kempclient
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestIsCollectableContentRule(t *testing.T) {
+	legacy := []ContentRuleMatcher{LegacyHeaderContentRules("my-vs", "other")}
+
+	tests := []struct {
+		name     string
+		rule     ContentRule
+		legacy   []ContentRuleMatcher
+		expected bool
+	}{
+		{
+			name:     "owned",
+			rule:     NewAddHeaderRule(HeaderContentRuleName("my-vs", "X-Test"), "X-Test", "value"),
+			expected: true,
+		},
+		{
+			name:     "legacy without matcher",
+			rule:     NewAddHeaderRule("myvsXTest", "X-Test", "value"),
+			expected: false,
+		},
+		{
+			name:     "legacy",
+			rule:     NewAddHeaderRule("myvsXTest", "X-Test", "value"),
+			legacy:   legacy,
+			expected: true,
+		},
+		{
+			name:     "legacy of unknown virtual service",
+			rule:     NewAddHeaderRule("unknownXTest", "X-Test", "value"),
+			legacy:   legacy,
+			expected: false,
+		},
+		{
+			name:     "foreign rule type",
+			rule:     NewDeleteHeaderRule("myvsXTest", "X-Test"),
+			legacy:   legacy,
+			expected: false,
+		},
+		{
+			name:     "shared rule",
+			rule:     NewDeleteHeaderRule(DeleteHeaderProtoName, DeleteHeaderProtoValue),
+			legacy:   legacy,
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		if got := isCollectableContentRule(test.rule, test.legacy); got != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestGarbageCollectRenamedHeaderContentRule(t *testing.T) {
+	oldRule := HeaderContentRuleName("old", "X-Test")
+	newRule := HeaderContentRuleName("new", "X-Test")
+
+	fake, c := newFakeLoadMaster(t)
+	fake.handle("showvs", showVirtualServiceHandler(1, "old", oldRule))
+	// The old rule is detached by the rename, but deleting it fails.
+	fake.fail("delrule", map[string]string{"name": oldRule})
+
+	_, err := c.UpdateVirtualService(1, VirtualServiceParams{
+		Name:    "new",
+		Headers: map[string]string{"X-Test": "value"},
+	})
+	if err == nil {
+		t.Fatalf("expected deleting the old rule to fail")
+	}
+
+	fake.handle("delrule", nil)
+	fake.handle("showrule", func(query url.Values) (int, string) {
+		return http.StatusOK, `<Response stat="200" code="ok"><Success><Data>` +
+			`<AddHeaderRule><Name>` + oldRule + `</Name><Header>X-Test</Header></AddHeaderRule>` +
+			`<AddHeaderRule><Name>` + newRule + `</Name><Header>X-Test</Header></AddHeaderRule>` +
+			`</Data></Success></Response>`
+	})
+	fake.handle("listvs", func(query url.Values) (int, string) {
+		return http.StatusOK, `<Response stat="200" code="ok"><Success><Data><VS><Index>1</Index><NickName>new</NickName>` +
+			`<RequestRules>` + newRule + `</RequestRules></VS></Data></Success></Response>`
+	})
+	fake.reset()
+
+	result, err := c.GarbageCollectContentRules(false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Orphans) != 1 || result.Orphans[0] != oldRule {
+		t.Errorf("expected %s to be orphaned, got %v", oldRule, result.Orphans)
+	}
+	expectCommands(t, fake.sent("delrule"), []string{"delrule name=" + oldRule})
+}
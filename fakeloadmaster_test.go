@@ -0,0 +1,113 @@
+package kempclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const fakeSuccess = `<Response stat="200" code="ok"><Success>Command completed ok</Success></Response>`
+
+// fakeLoadMaster records the commands sent to it. Commands without a handler
+// succeed with an empty response.
+type fakeLoadMaster struct {
+	mutex    sync.Mutex
+	commands []string
+	handlers map[string]func(query url.Values) (int, string)
+}
+
+func newFakeLoadMaster(t *testing.T) (*fakeLoadMaster, *Client) {
+	fake := &fakeLoadMaster{handlers: make(map[string]func(query url.Values) (int, string))}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, NewClient(Config{Endpoint: server.URL + "/"})
+}
+
+func (f *fakeLoadMaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cmd := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+
+	f.mutex.Lock()
+	f.commands = append(f.commands, fakeCommand(cmd, query))
+	handler := f.handlers[cmd]
+	f.mutex.Unlock()
+
+	status, body := http.StatusOK, fakeSuccess
+	if handler != nil {
+		status, body = handler(query)
+	}
+
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
+
+// fakeCommand formats a command like it is recorded, e.g. "delrule name=x".
+func fakeCommand(cmd string, query url.Values) string {
+	if len(query) == 0 {
+		return cmd
+	}
+
+	return cmd + " " + query.Encode()
+}
+
+func (f *fakeLoadMaster) handle(cmd string, handler func(query url.Values) (int, string)) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.handlers[cmd] = handler
+}
+
+// fail makes the command fail for requests matching all given parameters.
+func (f *fakeLoadMaster) fail(cmd string, parameters map[string]string) {
+	f.handle(cmd, func(query url.Values) (int, string) {
+		for key, value := range parameters {
+			if query.Get(key) != value {
+				return http.StatusOK, fakeSuccess
+			}
+		}
+
+		return http.StatusUnprocessableEntity, `<Response stat="422" code="fail"><Error>Injected failure</Error></Response>`
+	})
+}
+
+// sent returns the recorded commands which are one of cmds, all if cmds is
+// empty.
+func (f *fakeLoadMaster) sent(cmds ...string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	filter := make(map[string]bool)
+	for _, cmd := range cmds {
+		filter[cmd] = true
+	}
+
+	result := []string{}
+	for _, command := range f.commands {
+		if len(filter) > 0 && !filter[strings.SplitN(command, " ", 2)[0]] {
+			continue
+		}
+		result = append(result, command)
+	}
+
+	return result
+}
+
+func (f *fakeLoadMaster) reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.commands = nil
+}
+
+func expectCommands(t *testing.T, got, expected []string) {
+	t.Helper()
+
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected commands\n  %s\ngot\n  %s", strings.Join(expected, "\n  "), strings.Join(got, "\n  "))
+	}
+}
@@ -0,0 +1,166 @@
+package kempclient
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/juju/errgo"
+)
+
+// Fleet holds the clients of several LoadMasters by name. Every LoadMaster can
+// have labels, e.g. the datacenter, to select it for reads and writes.
+type Fleet struct {
+	mutex   sync.RWMutex
+	members map[string]FleetMember
+}
+
+type FleetMember struct {
+	Name   string
+	Client *Client
+	Labels map[string]string
+}
+
+// FleetVirtualServices is the result of ListVirtualServices of a single
+// LoadMaster of a fleet.
+type FleetVirtualServices struct {
+	VirtualServices []VirtualService
+	Err             error
+}
+
+// FleetStatistics is the result of GetStatistics of a single LoadMaster of a
+// fleet.
+type FleetStatistics struct {
+	Statistics Statistics
+	Err        error
+}
+
+func NewFleet() *Fleet {
+	return &Fleet{
+		members: make(map[string]FleetMember),
+	}
+}
+
+// Add adds the client under the given name, replacing a client with the same
+// name.
+func (f *Fleet) Add(name string, client *Client, labels map[string]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.members[name] = FleetMember{
+		Name:   name,
+		Client: client,
+		Labels: labels,
+	}
+}
+
+func (f *Fleet) Remove(name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.members, name)
+}
+
+// Client returns the client with the given name.
+func (f *Fleet) Client(name string) (*Client, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	member, ok := f.members[name]
+	if !ok {
+		return nil, errgo.Newf("LoadMaster %s is not part of the fleet", name)
+	}
+
+	return member.Client, nil
+}
+
+// Select returns the members having all labels of the selector, ordered by
+// name. An empty selector selects all members.
+func (f *Fleet) Select(selector map[string]string) []FleetMember {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	members := []FleetMember{}
+	for _, member := range f.members {
+		if matchesLabels(member.Labels, selector) {
+			members = append(members, member)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+
+	return members
+}
+
+func matchesLabels(labels, selector map[string]string) bool {
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Each calls fn concurrently for every selected LoadMaster and returns the
+// errors by name. LoadMasters for which fn succeeded are not part of the
+// result.
+func (f *Fleet) Each(selector map[string]string, fn func(name string, c *Client) error) map[string]error {
+	var mutex sync.Mutex
+	errors := make(map[string]error)
+
+	f.each(selector, func(member FleetMember) {
+		if err := fn(member.Name, member.Client); err != nil {
+			mutex.Lock()
+			errors[member.Name] = err
+			mutex.Unlock()
+		}
+	})
+
+	return errors
+}
+
+// ListVirtualServices lists the virtual services of every selected LoadMaster.
+func (f *Fleet) ListVirtualServices(selector map[string]string) map[string]FleetVirtualServices {
+	var mutex sync.Mutex
+	results := make(map[string]FleetVirtualServices)
+
+	f.each(selector, func(member FleetMember) {
+		list, err := member.Client.ListVirtualServices()
+
+		mutex.Lock()
+		results[member.Name] = FleetVirtualServices{VirtualServices: list, Err: err}
+		mutex.Unlock()
+	})
+
+	return results
+}
+
+// GetStatistics returns the statistics of every selected LoadMaster.
+func (f *Fleet) GetStatistics(selector map[string]string) map[string]FleetStatistics {
+	var mutex sync.Mutex
+	results := make(map[string]FleetStatistics)
+
+	f.each(selector, func(member FleetMember) {
+		stats, err := member.Client.GetStatistics()
+
+		mutex.Lock()
+		results[member.Name] = FleetStatistics{Statistics: stats, Err: err}
+		mutex.Unlock()
+	})
+
+	return results
+}
+
+func (f *Fleet) each(selector map[string]string, fn func(member FleetMember)) {
+	var wg sync.WaitGroup
+	for _, member := range f.Select(selector) {
+		wg.Add(1)
+		go func(member FleetMember) {
+			defer wg.Done()
+			fn(member)
+		}(member)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,168 @@
+package kempclient
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/juju/errgo"
+)
+
+// DefaultHAStatusParameter is the parameter returning the HA state of the unit
+// answering the request.
+const DefaultHAStatusParameter = "hastatus"
+
+var (
+	// errUnreachable is the cause of errors where the LoadMaster did not
+	// answer. The request might have been processed nevertheless.
+	errUnreachable = errgo.New("LoadMaster unreachable")
+	// errNotConnected is the cause of errors where no connection to the
+	// LoadMaster could be established, so the request has not been sent.
+	errNotConnected = errgo.New("LoadMaster not connected")
+	// errStandby is the cause of errors where the unit refused the request as
+	// it is not the active unit of a HA pair.
+	errStandby = errgo.New("LoadMaster unit is standby")
+)
+
+// haEndpoints tracks which of the configured endpoints is the active unit of a
+// HA pair.
+type haEndpoints struct {
+	mutex           sync.Mutex
+	endpoints       []string
+	statusParameter string
+	// active is the index of the active endpoint, it is only valid once
+	// detected is set.
+	active   int
+	detected bool
+}
+
+func (h *haEndpoints) enabled() bool {
+	return len(h.endpoints) > 1
+}
+
+// ActiveEndpoint returns the endpoint requests are currently sent to.
+func (c *Client) ActiveEndpoint() (string, error) {
+	return c.activeEndpoint()
+}
+
+func (c *Client) activeEndpoint() (string, error) {
+	h := c.ha
+	if !h.enabled() {
+		return h.endpoints[0], nil
+	}
+
+	h.mutex.Lock()
+	detected, active := h.detected, h.active
+	h.mutex.Unlock()
+
+	if detected {
+		return h.endpoints[active], nil
+	}
+
+	return c.detectActiveEndpoint()
+}
+
+// failover detects the active unit again after a request to endpoint failed.
+func (c *Client) failover(endpoint string) (string, error) {
+	active, err := c.detectActiveEndpoint()
+	if err != nil {
+		return "", errgo.Mask(err, errgo.Any)
+	}
+
+	if c.debug && active != endpoint {
+		fmt.Println("DEBUG: failover from", endpoint, "to", active)
+	}
+
+	return active, nil
+}
+
+// detectActiveEndpoint asks every endpoint for its HA state and uses the first
+// active one. If no unit reports to be active, the first reachable endpoint is
+// used.
+func (c *Client) detectActiveEndpoint() (string, error) {
+	h := c.ha
+
+	reachable := -1
+	active := -1
+	var lastErr error
+	for i, endpoint := range h.endpoints {
+		parameters := make(map[string]string)
+		parameters["param"] = h.statusParameter
+
+		data := ParameterResponse{}
+		err := c.request(endpoint, "get", parameters, &data)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if reachable < 0 {
+			reachable = i
+		}
+
+		for _, param := range data.Data.Parameters {
+			if param.XMLName.Local == h.statusParameter && isActiveHAStatus(param.Value) {
+				active = i
+			}
+		}
+		if active >= 0 {
+			break
+		}
+	}
+
+	if active < 0 {
+		active = reachable
+	}
+	if active < 0 {
+		return "", errgo.WithCausef(lastErr, errUnreachable, "kemp unable to reach any of %s", strings.Join(h.endpoints, ", "))
+	}
+
+	h.mutex.Lock()
+	h.active = active
+	h.detected = true
+	h.mutex.Unlock()
+
+	return h.endpoints[active], nil
+}
+
+func isActiveHAStatus(status string) bool {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "active", "master":
+		return true
+	}
+
+	return false
+}
+
+// isStandbyError returns whether the error message of a response means that
+// the unit is not the active unit of a HA pair.
+func isStandbyError(message string) bool {
+	message = strings.ToLower(message)
+	for _, s := range []string{"standby", "passive", "not master", "not the master"} {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shouldFailover returns whether the request should be retried on the active
+// unit. Requests are retried if the unit reported to be standby or no
+// connection could be established. Reading requests are also retried if the
+// LoadMaster did not answer, changing requests are not, as they might have
+// been applied already. Other errors are returned by the LoadMaster for the
+// request itself and are never retried.
+func (c *Client) shouldFailover(cmd string, err error) bool {
+	if !c.ha.enabled() {
+		return false
+	}
+
+	switch errgo.Cause(err) {
+	case errStandby, errNotConnected:
+		return true
+	case errUnreachable:
+		return isReadCommand(cmd)
+	}
+
+	return false
+}
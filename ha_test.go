@@ -0,0 +1,129 @@
+package kempclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeHAPair serves the units "a", "b" and "c" under their name as path
+// prefix. Only the active unit accepts delrule, the standby units answer with
+// a standby error.
+type fakeHAPair struct {
+	mutex    sync.Mutex
+	active   string
+	requests map[string]int
+	// ruleExists makes delrule on the active unit succeed.
+	ruleExists bool
+}
+
+func (f *fakeHAPair) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	unit, cmd := parts[0], parts[1]
+	f.requests[unit+" "+cmd]++
+
+	switch {
+	case cmd == "get":
+		status := "standby"
+		if unit == f.active {
+			status = "active"
+		}
+		fmt.Fprintf(w, `<Response stat="200" code="ok"><Success><Data><hastatus>%s</hastatus></Data></Success></Response>`, status)
+	case unit != f.active:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `<Response stat="422" code="fail"><Error>Command not available, unit is in standby mode</Error></Response>`)
+	case !f.ruleExists:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `<Response stat="422" code="fail"><Error>Rule not found</Error></Response>`)
+	default:
+		fmt.Fprint(w, `<Response stat="200" code="ok"><Success>Command completed ok</Success></Response>`)
+	}
+}
+
+func newFakeHAPair(t *testing.T, active string) (*fakeHAPair, *Client) {
+	fake := &fakeHAPair{active: active, requests: make(map[string]int)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	c := NewClient(Config{
+		Endpoints: []string{server.URL + "/a/", server.URL + "/b/", server.URL + "/c/"},
+	})
+
+	return fake, c
+}
+
+func TestHAApplicationErrorsDoNotFailover(t *testing.T) {
+	fake, c := newFakeHAPair(t, "a")
+
+	for i := 0; i < 5; i++ {
+		if err := c.DeleteContentRule("missing"); err == nil {
+			t.Fatalf("expected an error")
+		}
+	}
+
+	if fake.requests["a get"] != 1 || fake.requests["b get"] != 0 || fake.requests["c get"] != 0 {
+		t.Errorf("expected the active unit to be detected once, got %v", fake.requests)
+	}
+	if fake.requests["a delrule"] != 5 {
+		t.Errorf("expected 5 delrule requests to the active unit, got %v", fake.requests)
+	}
+}
+
+func TestHAStandbyResponseFailsOver(t *testing.T) {
+	fake, c := newFakeHAPair(t, "a")
+	fake.ruleExists = true
+
+	endpoint, err := c.ActiveEndpoint()
+	if err != nil || !strings.HasSuffix(endpoint, "/a/") {
+		t.Fatalf("expected unit a to be active, got %s, %v", endpoint, err)
+	}
+
+	fake.mutex.Lock()
+	fake.active = "b"
+	fake.mutex.Unlock()
+
+	if err := c.DeleteContentRule("rule"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fake.requests["a delrule"] != 1 || fake.requests["b delrule"] != 1 {
+		t.Errorf("expected delrule to be retried on unit b, got %v", fake.requests)
+	}
+	endpoint, _ = c.ActiveEndpoint()
+	if !strings.HasSuffix(endpoint, "/b/") {
+		t.Errorf("expected unit b to be active, got %s", endpoint)
+	}
+}
+
+func TestShouldFailover(t *testing.T) {
+	c := NewClient(Config{Endpoints: []string{"a", "b"}})
+
+	tests := []struct {
+		cmd      string
+		err      error
+		expected bool
+	}{
+		{cmd: "listvs", err: errUnreachable, expected: true},
+		{cmd: "addvs", err: errUnreachable, expected: false},
+		{cmd: "addvs", err: errNotConnected, expected: true},
+		{cmd: "addvs", err: errStandby, expected: true},
+		{cmd: "delrule", err: fmt.Errorf("422 - Rule not found"), expected: false},
+	}
+
+	for _, test := range tests {
+		if got := c.shouldFailover(test.cmd, test.err); got != test.expected {
+			t.Errorf("%s %v: expected %t, got %t", test.cmd, test.err, test.expected, got)
+		}
+	}
+
+	single := NewClient(Config{Endpoint: "a"})
+	if single.shouldFailover("listvs", errUnreachable) {
+		t.Errorf("expected no failover without HA endpoints")
+	}
+}
@@ -0,0 +1,188 @@
+package kempclient
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// These are the types of a HealthCheck.
+const (
+	HealthCheckNone   = "none"
+	HealthCheckICMP   = "icmp"
+	HealthCheckTCP    = "tcp"
+	HealthCheckHTTP   = "http"
+	HealthCheckHTTPS  = "https"
+	HealthCheckSMTP   = "smtp"
+	HealthCheckNNTP   = "nntp"
+	HealthCheckFTP    = "ftp"
+	HealthCheckTelnet = "telnet"
+	HealthCheckPOP3   = "pop3"
+	HealthCheckIMAP   = "imap"
+	HealthCheckRDP    = "rdp"
+	HealthCheckLDAP   = "ldap"
+)
+
+// These are the methods of HTTP and HTTPS health checks, as used by the
+// checkuseget parameter.
+const (
+	HealthCheckMethodHead = "0"
+	HealthCheckMethodGet  = "1"
+	HealthCheckMethodPost = "2"
+)
+
+var healthCheckTypes = map[string]bool{
+	HealthCheckNone:   true,
+	HealthCheckICMP:   true,
+	HealthCheckTCP:    true,
+	HealthCheckHTTP:   true,
+	HealthCheckHTTPS:  true,
+	HealthCheckSMTP:   true,
+	HealthCheckNNTP:   true,
+	HealthCheckFTP:    true,
+	HealthCheckTelnet: true,
+	HealthCheckPOP3:   true,
+	HealthCheckIMAP:   true,
+	HealthCheckRDP:    true,
+	HealthCheckLDAP:   true,
+}
+
+// HealthCheck is the health check of the real servers of a virtual service.
+// URL, Method, UseHTTP11, HostHeader, ExpectedStatus, Pattern and PostData
+// only apply to HTTP and HTTPS checks.
+type HealthCheck struct {
+	Type string
+	// Port overrides the port of the real servers, it may be empty.
+	Port string
+
+	URL        string
+	Method     string
+	UseHTTP11  bool
+	HostHeader string
+	// ExpectedStatus are the status codes treated as healthy, besides 2xx
+	// and 3xx.
+	ExpectedStatus []int
+	// Pattern is a regular expression the response must match.
+	Pattern  string
+	PostData string
+}
+
+// NewHTTPHealthCheck returns a HTTP GET health check of the URL using
+// HTTP/1.1.
+func NewHTTPHealthCheck(url string) HealthCheck {
+	return HealthCheck{
+		Type:      HealthCheckHTTP,
+		URL:       url,
+		Method:    HealthCheckMethodGet,
+		UseHTTP11: true,
+	}
+}
+
+// NewTCPHealthCheck returns a health check connecting to the port of the real
+// servers.
+func NewTCPHealthCheck() HealthCheck {
+	return HealthCheck{Type: HealthCheckTCP}
+}
+
+// NewICMPHealthCheck returns a health check pinging the real servers.
+func NewICMPHealthCheck() HealthCheck {
+	return HealthCheck{Type: HealthCheckICMP}
+}
+
+func (h HealthCheck) isHTTP() bool {
+	return h.Type == HealthCheckHTTP || h.Type == HealthCheckHTTPS
+}
+
+// Validate checks that the fields are valid for the type of the health check.
+func (h HealthCheck) Validate() error {
+	if !healthCheckTypes[h.Type] {
+		return errgo.Newf("unknown health check type '%s'", h.Type)
+	}
+
+	if h.Port != "" {
+		if port, err := strconv.Atoi(h.Port); err != nil || port < 1 || port > 65535 {
+			return errgo.Newf("invalid health check port '%s'", h.Port)
+		}
+	}
+
+	if !h.isHTTP() {
+		if h.URL != "" || h.Method != "" || h.HostHeader != "" || len(h.ExpectedStatus) > 0 || h.Pattern != "" || h.PostData != "" {
+			return errgo.Newf("%s health checks do not support HTTP options", h.Type)
+		}
+
+		return nil
+	}
+
+	switch h.Method {
+	case "", HealthCheckMethodHead, HealthCheckMethodGet, HealthCheckMethodPost:
+	default:
+		return errgo.Newf("unknown health check method '%s'", h.Method)
+	}
+	if h.PostData != "" && h.Method != HealthCheckMethodPost {
+		return errgo.New("health check post data requires the POST method")
+	}
+	if h.URL != "" && !strings.HasPrefix(h.URL, "/") {
+		return errgo.Newf("health check url '%s' must start with /", h.URL)
+	}
+	for _, status := range h.ExpectedStatus {
+		if status < 100 || status > 599 {
+			return errgo.Newf("invalid health check status code %d", status)
+		}
+	}
+
+	return nil
+}
+
+func (h HealthCheck) setParameters(parameters map[string]string) {
+	parameters["checktype"] = h.Type
+	parameters["checkport"] = h.Port
+
+	if !h.isHTTP() {
+		return
+	}
+
+	parameters["checkurl"] = h.URL
+	if h.Method != "" {
+		parameters["checkuseget"] = h.Method
+	}
+	parameters["checkuse1.1"] = yesNo(h.UseHTTP11)
+	parameters["checkhost"] = h.HostHeader
+	parameters["checkpattern"] = h.Pattern
+	parameters["checkpostdata"] = h.PostData
+
+	codes := []string{}
+	for _, status := range h.ExpectedStatus {
+		codes = append(codes, strconv.Itoa(status))
+	}
+	parameters["checkcodes"] = strings.Join(codes, " ")
+}
+
+// HealthCheck returns the health check of the virtual service.
+func (vs VirtualService) HealthCheck() HealthCheck {
+	h := HealthCheck{
+		Type: strings.ToLower(vs.CheckType),
+		Port: vs.CheckPort,
+	}
+	if h.Port == "0" {
+		h.Port = ""
+	}
+
+	if !h.isHTTP() {
+		return h
+	}
+
+	h.URL = vs.CheckURL
+	h.Method = vs.CheckUseGet
+	h.UseHTTP11 = parseBool(vs.CheckUse11)
+	h.HostHeader = vs.CheckHost
+	h.Pattern = vs.CheckPattern
+	h.PostData = vs.CheckPostData
+	for _, code := range splitList(vs.CheckCodes) {
+		if status, err := strconv.Atoi(code); err == nil {
+			h.ExpectedStatus = append(h.ExpectedStatus, status)
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,91 @@
+package kempclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// RollbackError is returned when an operation failed after some of its steps
+// have already been applied to the LoadMaster. The completed steps are undone
+// in reverse order, RollbackErrors holds the errors of steps which could not be
+// undone.
+type RollbackError struct {
+	Err            error
+	Steps          []string
+	RollbackErrors []error
+}
+
+func (e *RollbackError) Error() string {
+	msg := fmt.Sprintf("%s (rolled back %d steps)", e.Err, len(e.Steps))
+	if len(e.RollbackErrors) == 0 {
+		return msg
+	}
+
+	rollbackErrors := []string{}
+	for _, err := range e.RollbackErrors {
+		rollbackErrors = append(rollbackErrors, err.Error())
+	}
+
+	return fmt.Sprintf("%s, rollback failed: %s", msg, strings.Join(rollbackErrors, "; "))
+}
+
+func (e *RollbackError) Underlying() error {
+	return e.Err
+}
+
+// Cause returns the cause of the error of the failed step, so that errgo.Cause
+// sees through the RollbackError.
+func (e *RollbackError) Cause() error {
+	return errgo.Cause(e.Err)
+}
+
+// Unwrap returns the error of the failed step for errors.Is and errors.As.
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// journal records the mutating steps of an operation so that they can be
+// undone if a later step fails. A nil journal records nothing.
+type journal struct {
+	steps []journalStep
+}
+
+type journalStep struct {
+	description string
+	undo        func() error
+}
+
+func (j *journal) record(description string, undo func() error) {
+	if j == nil {
+		return
+	}
+
+	j.steps = append(j.steps, journalStep{description: description, undo: undo})
+}
+
+// rollback undoes all recorded steps in reverse order and returns a
+// RollbackError wrapping err. If no step has been recorded, err is returned
+// unchanged.
+func (j *journal) rollback(err error) error {
+	if j == nil || len(j.steps) == 0 {
+		return err
+	}
+
+	rollbackErr := &RollbackError{Err: err}
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		step := j.steps[i]
+		rollbackErr.Steps = append(rollbackErr.Steps, step.description)
+
+		if step.undo == nil {
+			continue
+		}
+		if err := step.undo(); err != nil {
+			rollbackErr.RollbackErrors = append(rollbackErr.RollbackErrors, errgo.Notef(err, "undo %s", step.description))
+		}
+	}
+	j.steps = nil
+
+	return rollbackErr
+}
@@ -0,0 +1,101 @@
+package kempclient
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/juju/errgo"
+)
+
+func TestJournalRollbackWithoutSteps(t *testing.T) {
+	err := errors.New("failed")
+
+	if got := (&journal{}).rollback(err); got != err {
+		t.Errorf("expected the error to be returned unchanged, got %#v", got)
+	}
+}
+
+func TestRollbackErrorCause(t *testing.T) {
+	j := &journal{}
+	j.record("step", func() error { return nil })
+
+	err := j.rollback(errgo.WithCausef(nil, ErrParameterConflict, "conflict"))
+	if _, ok := err.(*RollbackError); !ok {
+		t.Fatalf("expected a *RollbackError, got %#v", err)
+	}
+	if !IsParameterConflict(err) {
+		t.Errorf("expected the cause to be visible through the RollbackError")
+	}
+	if errgo.Cause(err) != ErrParameterConflict {
+		t.Errorf("expected errgo.Cause to return the cause, got %#v", errgo.Cause(err))
+	}
+
+	j.record("step", func() error { return nil })
+	wrapped := errors.New("wrapped")
+	err = j.rollback(wrapped)
+	if _, ok := err.(*RollbackError); !ok || !errors.Is(err, wrapped) {
+		t.Errorf("expected errors.Is to unwrap the RollbackError, got %#v", err)
+	}
+}
+
+func TestAddVirtualServiceRollback(t *testing.T) {
+	fake, c := newFakeLoadMaster(t)
+	fake.fail("addrequestrule", map[string]string{"rule": "r2"})
+
+	header := HeaderContentRuleName("web", "X-Test")
+	_, err := c.AddVirtualService(VirtualServiceParams{
+		Name:                "web",
+		IPAddress:           "10.0.0.1",
+		Port:                "80",
+		Protocol:            "tcp",
+		Headers:             map[string]string{"X-Test": "value"},
+		ContentRequestRules: []string{"r1", "r2"},
+	})
+
+	rollbackErr, ok := err.(*RollbackError)
+	if !ok {
+		t.Fatalf("expected a *RollbackError, got %#v", err)
+	}
+	if len(rollbackErr.RollbackErrors) != 0 {
+		t.Errorf("unexpected rollback errors %v", rollbackErr.RollbackErrors)
+	}
+
+	sent := fake.sent()
+	failed := -1
+	for i, command := range sent {
+		if strings.HasPrefix(command, "addrequestrule") && strings.Contains(command, "rule=r2") {
+			failed = i
+		}
+	}
+	if failed < 0 {
+		t.Fatalf("expected the failing request, got %v", sent)
+	}
+
+	expectCommands(t, sent[failed+1:], []string{
+		"delrequestrule port=80&prot=tcp&rule=r1&vs=10.0.0.1",
+		"delrequestrule port=80&prot=tcp&rule=" + header + "&vs=10.0.0.1",
+		"delvs port=80&prot=tcp&vs=10.0.0.1",
+		"delrule name=" + header,
+	})
+}
+
+func TestAddVirtualServiceFirstStepFails(t *testing.T) {
+	fake, c := newFakeLoadMaster(t)
+	header := HeaderContentRuleName("web", "X-Test")
+	fake.fail("addrule", map[string]string{"name": header})
+
+	_, err := c.AddVirtualService(VirtualServiceParams{
+		Name:      "web",
+		IPAddress: "10.0.0.1",
+		Port:      "80",
+		Protocol:  "tcp",
+		Headers:   map[string]string{"X-Test": "value"},
+	})
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if _, ok := err.(*RollbackError); ok {
+		t.Errorf("expected the original error without a rollback, got %v", err)
+	}
+}
@@ -1,11 +1,17 @@
 package kempclient
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/juju/errgo"
 )
@@ -15,13 +21,48 @@ type Config struct {
 	Password string
 	Endpoint string
 	Debug    bool
+
+	// Endpoints are the addresses of a LoadMaster HA pair, usually the shared
+	// address followed by the addresses of both units. If set, Endpoint is
+	// ignored. Changing requests are sent to the active unit, see
+	// HAStatusParameter.
+	Endpoints []string
+	// HAStatusParameter is the parameter read via `get` to detect the active
+	// unit. It defaults to DefaultHAStatusParameter.
+	HAStatusParameter string
+
+	// ReadRateLimit and WriteRateLimit limit the requests per second sent to
+	// the LoadMaster for reading and changing commands. 0 disables the limit.
+	// ReadBurst and WriteBurst are the number of requests which may be sent at
+	// once, they default to 1.
+	ReadRateLimit  float64
+	ReadBurst      int
+	WriteRateLimit float64
+	WriteBurst     int
+
+	// CacheTTL enables caching the results of ListVirtualServices,
+	// ShowVirtualServiceByID and Get for the given duration. The cache is
+	// invalidated by every changing request of the client.
+	CacheTTL time.Duration
 }
 
 type Client struct {
 	user     string
 	password string
-	endpoint string
 	debug    bool
+
+	ha *haEndpoints
+
+	// httpClient is shared by all requests, so that connections are reused.
+	httpClient *http.Client
+
+	readLimiter  *rateLimiter
+	writeLimiter *rateLimiter
+	cache        *cache
+
+	// protoPortRulesMutex serializes AddProtoPortHeaderRequestRules, as
+	// concurrent calls would all try to add the shared rules.
+	protoPortRulesMutex sync.Mutex
 }
 
 type ParameterResponse struct {
@@ -43,14 +84,53 @@ func NewClient(config Config) *Client {
 	c := &Client{
 		user:     config.User,
 		password: config.Password,
-		endpoint: config.Endpoint,
 		debug:    config.Debug,
+
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+
+		readLimiter:  newRateLimiter(config.ReadRateLimit, config.ReadBurst),
+		writeLimiter: newRateLimiter(config.WriteRateLimit, config.WriteBurst),
+		cache:        newCache(config.CacheTTL),
+	}
+
+	endpoints := config.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{config.Endpoint}
+	}
+	statusParameter := config.HAStatusParameter
+	if statusParameter == "" {
+		statusParameter = DefaultHAStatusParameter
+	}
+	c.ha = &haEndpoints{
+		endpoints:       endpoints,
+		statusParameter: statusParameter,
 	}
 
 	return c
 }
 
 func (c *Client) Get(param string) (string, error) {
+	if value, ok := c.cache.get("get/" + param); ok {
+		return value.(string), nil
+	}
+
+	generation := c.cache.currentGeneration()
+	value, err := c.get(param)
+	if err != nil {
+		return "", errgo.Mask(err, errgo.Any)
+	}
+
+	c.cache.set("get/"+param, value, generation)
+
+	return value, nil
+}
+
+// get reads the parameter bypassing the cache.
+func (c *Client) get(param string) (string, error) {
 	parameters := make(map[string]string)
 	parameters["param"] = param
 
@@ -72,50 +152,130 @@ func (c *Client) Get(param string) (string, error) {
 	return result[param], nil
 }
 
+// Set sets the parameter and returns its old value. Use the typed setters, e.g.
+// SetHostname, if the old value is not needed.
 func (c *Client) Set(param, value string) (string, error) {
-	data, err := c.Get(param)
-	if err != nil {
+	if err := ValidateParameter(param, value); err != nil {
 		return "", errgo.Mask(err)
 	}
 
-	parameters := make(map[string]string)
-	parameters["param"] = param
-	parameters["value"] = value
-	err = c.Request("set", parameters, &ParameterResponse{})
+	// The old value is read bypassing the cache, as it might be stale.
+	data, err := c.get(param)
 	if err != nil {
-		return "", errgo.NoteMask(err, fmt.Sprintf("kemp set '%s %s' failed", param, value), errgo.Any)
+		return "", errgo.Mask(err)
+	}
+
+	if err := c.setParameter(param, value); err != nil {
+		return "", errgo.Mask(err, errgo.Any)
 	}
 
 	return data, nil
 }
 
 func (c *Client) Request(cmd string, parameters map[string]string, data interface{}) error {
+	if !isReadCommand(cmd) {
+		// Invalidate after the request as well, so that reads overlapping the
+		// change are not cached, see cache.set.
+		c.cache.invalidate()
+		defer c.cache.invalidate()
+	}
+
+	endpoint, err := c.activeEndpoint()
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	err = c.request(endpoint, cmd, parameters, data)
+	if err == nil || !c.shouldFailover(cmd, err) {
+		return err
+	}
+
+	failoverEndpoint, failoverErr := c.failover(endpoint)
+	if failoverErr != nil || failoverEndpoint == endpoint {
+		return err
+	}
+
+	return c.request(failoverEndpoint, cmd, parameters, data)
+}
+
+// request sends the command to the given endpoint and decodes the response
+// into data.
+func (c *Client) request(endpoint, cmd string, parameters map[string]string, data interface{}) error {
+	res, err := c.send(context.Background(), endpoint, "GET", cmd, parameters, nil)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+	defer res.Body.Close()
+
+	return c.parseSuccess(res.Body, data)
+}
+
+// requestStream sends the command with an optional binary body to the active
+// endpoint and returns the response without decoding it. The caller has to
+// close the body of the response. Requests without a body are retried on the
+// other unit of a HA pair like Request does.
+func (c *Client) requestStream(ctx context.Context, method, cmd string, parameters map[string]string, body io.Reader) (*http.Response, error) {
+	if !isReadCommand(cmd) {
+		c.cache.invalidate()
+		defer c.cache.invalidate()
+	}
+
+	endpoint, err := c.activeEndpoint()
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+
+	res, err := c.send(ctx, endpoint, method, cmd, parameters, body)
+	if err == nil || body != nil || !c.shouldFailover(cmd, err) {
+		return res, err
+	}
+
+	failoverEndpoint, failoverErr := c.failover(endpoint)
+	if failoverErr != nil || failoverEndpoint == endpoint {
+		return nil, err
+	}
+
+	return c.send(ctx, failoverEndpoint, method, cmd, parameters, body)
+}
+
+// send sends the command to the given endpoint. Error responses are parsed
+// and returned as error, otherwise the caller has to close the body of the
+// response.
+func (c *Client) send(ctx context.Context, endpoint, method, cmd string, parameters map[string]string, body io.Reader) (*http.Response, error) {
 	params := url.Values{}
 	for key, val := range parameters {
 		params.Set(key, val)
 	}
 
-	requestURL := fmt.Sprintf("%s%s?%s", c.endpoint, cmd, params.Encode())
-	req, err := http.NewRequest("GET", requestURL, nil)
+	requestURL := fmt.Sprintf("%s%s?%s", endpoint, cmd, params.Encode())
+	req, err := http.NewRequest(method, requestURL, body)
 	if err != nil {
-		return errgo.NoteMask(err, fmt.Sprintf("kemp request to '%s' failed", requestURL), errgo.Any)
+		return nil, errgo.NoteMask(err, fmt.Sprintf("kemp request to '%s' failed", requestURL), errgo.Any)
 	}
+	req = req.WithContext(ctx)
 
 	req.SetBasicAuth(c.user, c.password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	if err := c.rateLimiter(cmd).wait(ctx); err != nil {
+		return nil, errgo.NoteMask(err, fmt.Sprintf("kemp request to '%s' failed", requestURL), errgo.Any)
 	}
-	client := &http.Client{Transport: tr}
 
-	res, err := client.Do(req)
+	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return errgo.NoteMask(err, fmt.Sprintf("kemp request to '%s' failed", requestURL), errgo.Any)
+		cause := errUnreachable
+		if opErr := (*net.OpError)(nil); errors.As(err, &opErr) && opErr.Op == "dial" {
+			cause = errNotConnected
+		}
+		return nil, errgo.WithCausef(err, cause, "kemp request to '%s' failed", requestURL)
 	}
 
 	if res.StatusCode >= 400 {
-		return c.parseError(res.StatusCode, res.Body)
+		defer res.Body.Close()
+		return nil, c.parseError(res.StatusCode, res.Body)
 	}
 
-	return c.parseSuccess(res.Body, data)
+	return res, nil
 }
@@ -0,0 +1,33 @@
+package kempclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSetReadsOldValueUncached(t *testing.T) {
+	fake, c := newFakeLoadMaster(t)
+	c.cache = newCache(time.Hour)
+
+	hostname := "old"
+	fake.handle("get", func(query url.Values) (int, string) {
+		return http.StatusOK, fmt.Sprintf(`<Response stat="200" code="ok"><Success><Data><hostname>%s</hostname></Data></Success></Response>`, hostname)
+	})
+
+	if _, err := c.Get("hostname"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Changed by someone else, the cached value is stale now.
+	hostname = "other"
+
+	old, err := c.Set("hostname", "new")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if old != "other" {
+		t.Errorf("expected the old value other, got %s", old)
+	}
+}
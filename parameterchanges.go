@@ -0,0 +1,98 @@
+package kempclient
+
+import (
+	"sort"
+
+	"github.com/juju/errgo"
+)
+
+// ErrParameterConflict is the cause of errors returned by CompareAndSet if the
+// parameter has been changed concurrently.
+var ErrParameterConflict = errgo.New("parameter conflict")
+
+// IsParameterConflict returns whether the error is caused by a conflicting
+// change of a parameter.
+func IsParameterConflict(err error) bool {
+	return errgo.Cause(err) == ErrParameterConflict
+}
+
+// ParameterChange is the result of applying a single parameter.
+type ParameterChange struct {
+	Name    string
+	Before  string
+	After   string
+	Changed bool
+}
+
+// CompareAndSet sets the parameter to value only if its current value is
+// expected. Otherwise an error caused by ErrParameterConflict is returned.
+//
+// The LoadMaster has no atomic operation for this, so changes between reading
+// and setting the parameter are not detected.
+func (c *Client) CompareAndSet(param, expected, value string) error {
+	if err := ValidateParameter(param, value); err != nil {
+		return errgo.Mask(err)
+	}
+
+	current, err := c.get(param)
+	if err != nil {
+		return errgo.Mask(err, errgo.Any)
+	}
+
+	if current != expected {
+		return errgo.WithCausef(nil, ErrParameterConflict, "kemp parameter %s is '%s', expected '%s'", param, current, expected)
+	}
+	if current == value {
+		return nil
+	}
+
+	return c.setParameter(param, value)
+}
+
+// ApplyParameters sets all parameters to the given values. Parameters which
+// already have the value are skipped. All values are validated before any
+// parameter is set. The changes are ordered by name and contain the
+// parameters applied until an error occurred.
+func (c *Client) ApplyParameters(parameters map[string]string) ([]ParameterChange, error) {
+	names := []string{}
+	for name, value := range parameters {
+		if err := ValidateParameter(name, value); err != nil {
+			return []ParameterChange{}, errgo.Mask(err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	current, err := c.getAll()
+	if err != nil {
+		return []ParameterChange{}, errgo.Mask(err, errgo.Any)
+	}
+
+	changes := []ParameterChange{}
+	for _, name := range names {
+		before, ok := current[name]
+		if !ok {
+			// Not every parameter is part of getall.
+			before, err = c.get(name)
+			if err != nil {
+				return changes, errgo.Mask(err, errgo.Any)
+			}
+		}
+
+		change := ParameterChange{
+			Name:   name,
+			Before: before,
+			After:  parameters[name],
+		}
+		if before != change.After {
+			if err := c.setParameter(name, change.After); err != nil {
+				return changes, errgo.Mask(err, errgo.Any)
+			}
+			change.Changed = true
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
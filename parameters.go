@@ -0,0 +1,471 @@
+package kempclient
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+// These are the global parameters of the LoadMaster with typed access.
+const (
+	ParamHostname           = "hostname"
+	ParamDNSServers         = "namserver"
+	ParamSearchList         = "searchlist"
+	ParamNTPHosts           = "ntphost"
+	ParamTimeZone           = "timezone"
+	ParamSyslogEmergency    = "syslogemergency"
+	ParamSyslogCritical     = "syslogcritical"
+	ParamSyslogError        = "syslogerror"
+	ParamSyslogWarn         = "syslogwarn"
+	ParamSyslogNotice       = "syslognotice"
+	ParamSyslogInfo         = "sysloginfo"
+	ParamSNMPEnable         = "snmpenable"
+	ParamSNMPContact        = "snmpcontact"
+	ParamSNMPLocation       = "snmplocation"
+	ParamSNMPCommunity      = "snmpcommunity"
+	ParamSessionIdleTimeout = "sessionidletime"
+	ParamCheckInterval      = "retryinterval"
+	ParamCheckTimeout       = "timeout"
+	ParamCheckRetryCount    = "retrycount"
+)
+
+// maxDNSServers is the number of name servers the LoadMaster accepts.
+const maxDNSServers = 3
+
+// ParameterDefinition describes a global parameter of the LoadMaster.
+type ParameterDefinition struct {
+	Name        string
+	Description string
+	// Validate checks a raw value before it is set, it may be nil.
+	Validate func(value string) error
+}
+
+// Parameters is the registry of the global parameters with typed access. Set
+// validates values of these parameters before sending them.
+var Parameters = map[string]ParameterDefinition{
+	ParamHostname:           {Name: ParamHostname, Description: "host name of the LoadMaster", Validate: validateHostname},
+	ParamDNSServers:         {Name: ParamDNSServers, Description: "space separated name servers", Validate: validateDNSServers},
+	ParamSearchList:         {Name: ParamSearchList, Description: "space separated DNS search domains"},
+	ParamNTPHosts:           {Name: ParamNTPHosts, Description: "space separated NTP servers", Validate: validateHostList},
+	ParamTimeZone:           {Name: ParamTimeZone, Description: "time zone, e.g. Europe/Berlin", Validate: validateNotEmpty},
+	ParamSyslogEmergency:    {Name: ParamSyslogEmergency, Description: "syslog hosts receiving emergency messages", Validate: validateIPList},
+	ParamSyslogCritical:     {Name: ParamSyslogCritical, Description: "syslog hosts receiving critical messages", Validate: validateIPList},
+	ParamSyslogError:        {Name: ParamSyslogError, Description: "syslog hosts receiving error messages", Validate: validateIPList},
+	ParamSyslogWarn:         {Name: ParamSyslogWarn, Description: "syslog hosts receiving warning messages", Validate: validateIPList},
+	ParamSyslogNotice:       {Name: ParamSyslogNotice, Description: "syslog hosts receiving notice messages", Validate: validateIPList},
+	ParamSyslogInfo:         {Name: ParamSyslogInfo, Description: "syslog hosts receiving info messages", Validate: validateIPList},
+	ParamSNMPEnable:         {Name: ParamSNMPEnable, Description: "whether SNMP is enabled", Validate: validateBool},
+	ParamSNMPContact:        {Name: ParamSNMPContact, Description: "SNMP contact"},
+	ParamSNMPLocation:       {Name: ParamSNMPLocation, Description: "SNMP location"},
+	ParamSNMPCommunity:      {Name: ParamSNMPCommunity, Description: "SNMP community string"},
+	ParamSessionIdleTimeout: {Name: ParamSessionIdleTimeout, Description: "idle timeout of admin sessions in seconds", Validate: validatePositiveInt},
+	ParamCheckInterval:      {Name: ParamCheckInterval, Description: "interval of the real server health checks in seconds", Validate: validatePositiveInt},
+	ParamCheckTimeout:       {Name: ParamCheckTimeout, Description: "timeout of a real server health check in seconds", Validate: validatePositiveInt},
+	ParamCheckRetryCount:    {Name: ParamCheckRetryCount, Description: "failed health checks before a real server is marked down", Validate: validatePositiveInt},
+}
+
+// SyslogLevels are the syslog parameters ordered by severity.
+var SyslogLevels = []string{
+	ParamSyslogEmergency,
+	ParamSyslogCritical,
+	ParamSyslogError,
+	ParamSyslogWarn,
+	ParamSyslogNotice,
+	ParamSyslogInfo,
+}
+
+// GlobalParameters are the decoded global parameters returned by GetAll.
+type GlobalParameters struct {
+	Hostname    string
+	DNSServers  []string
+	SearchList  []string
+	NTPHosts    []string
+	TimeZone    string
+	SyslogHosts map[string][]string
+
+	SNMPEnabled   bool
+	SNMPContact   string
+	SNMPLocation  string
+	SNMPCommunity string
+
+	SessionIdleTimeout time.Duration
+
+	CheckInterval   time.Duration
+	CheckTimeout    time.Duration
+	CheckRetryCount int
+
+	// Raw holds all parameters returned by the LoadMaster, including those
+	// without typed access.
+	Raw map[string]string
+}
+
+// GetAll returns all global parameters of the LoadMaster.
+func (c *Client) GetAll() (GlobalParameters, error) {
+	raw, err := c.getAll()
+	if err != nil {
+		return GlobalParameters{}, errgo.Mask(err, errgo.Any)
+	}
+
+	params := GlobalParameters{
+		Hostname:      raw[ParamHostname],
+		DNSServers:    splitList(raw[ParamDNSServers]),
+		SearchList:    splitList(raw[ParamSearchList]),
+		NTPHosts:      splitList(raw[ParamNTPHosts]),
+		TimeZone:      raw[ParamTimeZone],
+		SyslogHosts:   make(map[string][]string),
+		SNMPEnabled:   parseBool(raw[ParamSNMPEnable]),
+		SNMPContact:   raw[ParamSNMPContact],
+		SNMPLocation:  raw[ParamSNMPLocation],
+		SNMPCommunity: raw[ParamSNMPCommunity],
+		Raw:           raw,
+	}
+
+	for _, level := range SyslogLevels {
+		params.SyslogHosts[level] = splitList(raw[level])
+	}
+
+	if seconds, err := strconv.Atoi(raw[ParamSessionIdleTimeout]); err == nil {
+		params.SessionIdleTimeout = time.Duration(seconds) * time.Second
+	}
+	if seconds, err := strconv.Atoi(raw[ParamCheckInterval]); err == nil {
+		params.CheckInterval = time.Duration(seconds) * time.Second
+	}
+	if seconds, err := strconv.Atoi(raw[ParamCheckTimeout]); err == nil {
+		params.CheckTimeout = time.Duration(seconds) * time.Second
+	}
+	if count, err := strconv.Atoi(raw[ParamCheckRetryCount]); err == nil {
+		params.CheckRetryCount = count
+	}
+
+	return params, nil
+}
+
+func (c *Client) getAll() (map[string]string, error) {
+	data := ParameterResponse{}
+	err := c.Request("getall", make(map[string]string), &data)
+	if err != nil {
+		return nil, errgo.NoteMask(err, "kemp getall failed", errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	result := make(map[string]string)
+	for _, param := range data.Data.Parameters {
+		result[param.XMLName.Local] = param.Value
+	}
+
+	return result, nil
+}
+
+func (c *Client) GetHostname() (string, error) {
+	return c.Get(ParamHostname)
+}
+
+func (c *Client) SetHostname(hostname string) error {
+	return c.setParameter(ParamHostname, hostname)
+}
+
+func (c *Client) GetDNSServers() ([]string, error) {
+	return c.getList(ParamDNSServers)
+}
+
+func (c *Client) SetDNSServers(servers []string) error {
+	return c.setParameter(ParamDNSServers, strings.Join(servers, " "))
+}
+
+func (c *Client) GetSearchList() ([]string, error) {
+	return c.getList(ParamSearchList)
+}
+
+func (c *Client) SetSearchList(domains []string) error {
+	return c.setParameter(ParamSearchList, strings.Join(domains, " "))
+}
+
+func (c *Client) GetNTPHosts() ([]string, error) {
+	return c.getList(ParamNTPHosts)
+}
+
+func (c *Client) SetNTPHosts(hosts []string) error {
+	return c.setParameter(ParamNTPHosts, strings.Join(hosts, " "))
+}
+
+func (c *Client) GetTimeZone() (string, error) {
+	return c.Get(ParamTimeZone)
+}
+
+func (c *Client) SetTimeZone(timeZone string) error {
+	return c.setParameter(ParamTimeZone, timeZone)
+}
+
+// GetSyslogHosts returns the hosts receiving messages of the given level, which
+// is one of SyslogLevels.
+func (c *Client) GetSyslogHosts(level string) ([]string, error) {
+	if !isSyslogLevel(level) {
+		return nil, errgo.Newf("%s is not a syslog level", level)
+	}
+
+	return c.getList(level)
+}
+
+func (c *Client) SetSyslogHosts(level string, hosts []string) error {
+	if !isSyslogLevel(level) {
+		return errgo.Newf("%s is not a syslog level", level)
+	}
+
+	return c.setParameter(level, strings.Join(hosts, " "))
+}
+
+func (c *Client) GetSNMPEnabled() (bool, error) {
+	value, err := c.Get(ParamSNMPEnable)
+	if err != nil {
+		return false, errgo.Mask(err, errgo.Any)
+	}
+
+	return parseBool(value), nil
+}
+
+func (c *Client) SetSNMPEnabled(enabled bool) error {
+	return c.setParameter(ParamSNMPEnable, yesNo(enabled))
+}
+
+func (c *Client) SetSNMPContact(contact string) error {
+	return c.setParameter(ParamSNMPContact, contact)
+}
+
+func (c *Client) SetSNMPLocation(location string) error {
+	return c.setParameter(ParamSNMPLocation, location)
+}
+
+func (c *Client) SetSNMPCommunity(community string) error {
+	return c.setParameter(ParamSNMPCommunity, community)
+}
+
+func (c *Client) GetSessionIdleTimeout() (time.Duration, error) {
+	return c.getSeconds(ParamSessionIdleTimeout)
+}
+
+func (c *Client) SetSessionIdleTimeout(timeout time.Duration) error {
+	return c.setSeconds(ParamSessionIdleTimeout, timeout)
+}
+
+// GetCheckInterval returns the interval of the real server health checks.
+func (c *Client) GetCheckInterval() (time.Duration, error) {
+	return c.getSeconds(ParamCheckInterval)
+}
+
+func (c *Client) SetCheckInterval(interval time.Duration) error {
+	return c.setSeconds(ParamCheckInterval, interval)
+}
+
+// GetCheckTimeout returns how long a real server health check may take.
+func (c *Client) GetCheckTimeout() (time.Duration, error) {
+	return c.getSeconds(ParamCheckTimeout)
+}
+
+func (c *Client) SetCheckTimeout(timeout time.Duration) error {
+	return c.setSeconds(ParamCheckTimeout, timeout)
+}
+
+// GetCheckRetryCount returns the number of failed health checks after which a
+// real server is marked down.
+func (c *Client) GetCheckRetryCount() (int, error) {
+	value, err := c.Get(ParamCheckRetryCount)
+	if err != nil {
+		return 0, errgo.Mask(err, errgo.Any)
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errgo.Notef(err, "kemp returned invalid %s '%s'", ParamCheckRetryCount, value)
+	}
+
+	return count, nil
+}
+
+func (c *Client) SetCheckRetryCount(count int) error {
+	return c.setParameter(ParamCheckRetryCount, strconv.Itoa(count))
+}
+
+func (c *Client) getSeconds(param string) (time.Duration, error) {
+	value, err := c.Get(param)
+	if err != nil {
+		return 0, errgo.Mask(err, errgo.Any)
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errgo.Notef(err, "kemp returned invalid %s '%s'", param, value)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (c *Client) setSeconds(param string, d time.Duration) error {
+	return c.setParameter(param, strconv.Itoa(int(d/time.Second)))
+}
+
+func (c *Client) getList(param string) ([]string, error) {
+	value, err := c.Get(param)
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+
+	return splitList(value), nil
+}
+
+// setParameter validates and sets the parameter. Unlike Set it does not read
+// the old value first.
+func (c *Client) setParameter(param, value string) error {
+	if err := ValidateParameter(param, value); err != nil {
+		return errgo.Mask(err)
+	}
+
+	parameters := make(map[string]string)
+	parameters["param"] = param
+	parameters["value"] = value
+	err := c.Request("set", parameters, &ParameterResponse{})
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp set '%s %s' failed", param, value), errgo.Any)
+	}
+
+	return nil
+}
+
+// ValidateParameter validates the value of a parameter in the Parameters
+// registry. Values of unknown parameters are always valid.
+func ValidateParameter(param, value string) error {
+	definition, ok := Parameters[param]
+	if !ok || definition.Validate == nil {
+		return nil
+	}
+
+	if err := definition.Validate(value); err != nil {
+		return errgo.Notef(err, "invalid value '%s' for %s", value, param)
+	}
+
+	return nil
+}
+
+// ParameterNames returns the names of all parameters in the registry, sorted.
+func ParameterNames() []string {
+	names := []string{}
+	for name := range Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func isSyslogLevel(level string) bool {
+	for _, l := range SyslogLevels {
+		if l == level {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitList(value string) []string {
+	return strings.Fields(value)
+}
+
+// isAlphanumericRune reports whether r is an ASCII letter or digit.
+func isAlphanumericRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func parseBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "y", "yes", "1", "on", "true", "enabled":
+		return true
+	}
+
+	return false
+}
+
+func validateNotEmpty(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errgo.New("value must not be empty")
+	}
+
+	return nil
+}
+
+func validateHostname(value string) error {
+	if len(value) == 0 || len(value) > 63 {
+		return errgo.New("host name must have 1 to 63 characters")
+	}
+	for i, r := range value {
+		if isAlphanumericRune(r) || (r == '-' && i != 0 && i != len(value)-1) {
+			continue
+		}
+		return errgo.Newf("host name must not contain '%c'", r)
+	}
+
+	return nil
+}
+
+func validateDNSServers(value string) error {
+	if len(splitList(value)) > maxDNSServers {
+		return errgo.Newf("at most %d name servers are allowed", maxDNSServers)
+	}
+
+	return validateIPList(value)
+}
+
+func validateIPList(value string) error {
+	for _, ip := range splitList(value) {
+		if net.ParseIP(ip) == nil {
+			return errgo.Newf("%s is not a valid ip address", ip)
+		}
+	}
+
+	return nil
+}
+
+func validateHostList(value string) error {
+	for _, host := range splitList(value) {
+		if net.ParseIP(host) == nil && validateDomain(host) != nil {
+			return errgo.Newf("%s is neither an ip address nor a host name", host)
+		}
+	}
+
+	return nil
+}
+
+func validateDomain(value string) error {
+	for _, label := range strings.Split(value, ".") {
+		if err := validateHostname(label); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateBool(value string) error {
+	switch strings.ToLower(value) {
+	case "y", "n", "yes", "no", "0", "1", "on", "off":
+		return nil
+	}
+
+	return errgo.Newf("%s is not a boolean", value)
+}
+
+func validatePositiveInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return errgo.Newf("%s is not a positive number", value)
+	}
+
+	return nil
+}
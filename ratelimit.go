@@ -0,0 +1,173 @@
+package kempclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// readCommands are the commands which do not change the LoadMaster. All other
+// commands count against the write rate limit.
+var readCommands = map[string]bool{
+	"backup":           true,
+	"get":              true,
+	"getall":           true,
+	"listcert":         true,
+	"listintermediate": true,
+	"listvs":           true,
+	"readcert":         true,
+	"readintermediate": true,
+	"showvs":           true,
+	"showrs":           true,
+	"showrule":         true,
+	"stats":            true,
+}
+
+func isReadCommand(cmd string) bool {
+	return readCommands[cmd]
+}
+
+// RateLimitStats are the metrics of the read and write rate limiters.
+type RateLimitStats struct {
+	Read  RateLimiterStats
+	Write RateLimiterStats
+}
+
+// RateLimiterStats are the metrics of a single rate limiter.
+type RateLimiterStats struct {
+	// QueueDepth is the number of requests currently waiting.
+	QueueDepth int
+	// Requests is the number of requests which passed the rate limiter.
+	Requests uint64
+	// Delayed is the number of requests which had to wait.
+	Delayed   uint64
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// rateLimiter is a token bucket. Requests reserve their token in the order
+// they arrive, so waiting requests are served first in first out. A nil
+// rateLimiter does not limit.
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	stats  RateLimiterStats
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until the request may be sent or the context is done. A
+// cancelled request gives its token back and is not counted in the stats.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		l.finish(delay)
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long the request has to wait for it.
+// Requests which do not have to wait are counted right away, waiting requests
+// by finish.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	l.tokens--
+	if l.tokens >= 0 {
+		l.stats.Requests++
+		return 0
+	}
+
+	l.stats.QueueDepth++
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func (l *rateLimiter) finish(delay time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.stats.QueueDepth--
+	l.stats.Requests++
+	l.stats.Delayed++
+	l.stats.TotalWait += delay
+	if delay > l.stats.MaxWait {
+		l.stats.MaxWait = delay
+	}
+}
+
+func (l *rateLimiter) cancel() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.stats.QueueDepth--
+	l.tokens++
+}
+
+func (l *rateLimiter) currentStats() RateLimiterStats {
+	if l == nil {
+		return RateLimiterStats{}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.stats
+}
+
+// RateLimitStats returns the metrics of the rate limiters configured by
+// Config.ReadRateLimit and Config.WriteRateLimit.
+func (c *Client) RateLimitStats() RateLimitStats {
+	return RateLimitStats{
+		Read:  c.readLimiter.currentStats(),
+		Write: c.writeLimiter.currentStats(),
+	}
+}
+
+func (c *Client) rateLimiter(cmd string) *rateLimiter {
+	if isReadCommand(cmd) {
+		return c.readLimiter
+	}
+
+	return c.writeLimiter
+}
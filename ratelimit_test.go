@@ -0,0 +1,31 @@
+package kempclient
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterCancelledWait(t *testing.T) {
+	l := newRateLimiter(1, 1)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected the wait to be cancelled, got %v", err)
+	}
+
+	stats := l.currentStats()
+	if stats.Requests != 1 || stats.Delayed != 0 || stats.TotalWait != 0 || stats.MaxWait != 0 || stats.QueueDepth != 0 {
+		t.Errorf("expected the cancelled request not to be counted, got %#v", stats)
+	}
+
+	// The token of the cancelled request is available again, so the next
+	// request only waits for the first token to be refilled.
+	if delay := l.reserve(); delay > time.Second {
+		t.Errorf("expected the cancelled token to be given back, got a delay of %s", delay)
+	}
+}
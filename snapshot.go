@@ -0,0 +1,108 @@
+package kempclient
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/juju/errgo"
+	"gopkg.in/yaml.v2"
+)
+
+// SnapshotVersion is the version of the snapshot format written by this
+// client.
+const SnapshotVersion = 1
+
+// Snapshot is the configuration of a LoadMaster at a point in time, as far as
+// this client can read it.
+type Snapshot struct {
+	Version         int               `json:"version" yaml:"version"`
+	CapturedAt      time.Time         `json:"capturedAt" yaml:"capturedAt"`
+	VirtualServices []VirtualService  `json:"virtualServices" yaml:"virtualServices"`
+	ContentRules    []ContentRule     `json:"contentRules" yaml:"contentRules"`
+	Parameters      map[string]string `json:"parameters" yaml:"parameters"`
+}
+
+// TakeSnapshot reads the virtual services with their real servers, the
+// content rules and the global parameters.
+func (c *Client) TakeSnapshot() (Snapshot, error) {
+	snapshot := Snapshot{
+		Version:    SnapshotVersion,
+		CapturedAt: time.Now().UTC(),
+	}
+
+	list, err := c.listVirtualServicesWithRealServers()
+	if err != nil {
+		return Snapshot{}, errgo.Mask(err, errgo.Any)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return virtualServiceKey(list[i]) < virtualServiceKey(list[j])
+	})
+	snapshot.VirtualServices = list
+
+	rules, err := c.ListContentRules()
+	if err != nil {
+		return Snapshot{}, errgo.Mask(err, errgo.Any)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Name < rules[j].Name
+	})
+	snapshot.ContentRules = rules
+
+	snapshot.Parameters, err = c.getAll()
+	if err != nil {
+		return Snapshot{}, errgo.Mask(err, errgo.Any)
+	}
+
+	return snapshot, nil
+}
+
+func (s Snapshot) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return errgo.Mask(encoder.Encode(s))
+}
+
+func (s Snapshot) WriteYAML(w io.Writer) error {
+	out, err := yaml.Marshal(s)
+	if err != nil {
+		return errgo.Mask(err)
+	}
+
+	_, err = w.Write(out)
+	return errgo.Mask(err)
+}
+
+func ReadSnapshotJSON(r io.Reader) (Snapshot, error) {
+	snapshot := Snapshot{}
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return Snapshot{}, errgo.Notef(err, "unable to decode snapshot")
+	}
+
+	return snapshot, checkSnapshotVersion(snapshot)
+}
+
+func ReadSnapshotYAML(r io.Reader) (Snapshot, error) {
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Snapshot{}, errgo.Mask(err)
+	}
+
+	snapshot := Snapshot{}
+	if err := yaml.Unmarshal(in, &snapshot); err != nil {
+		return Snapshot{}, errgo.Notef(err, "unable to decode snapshot")
+	}
+
+	return snapshot, checkSnapshotVersion(snapshot)
+}
+
+func checkSnapshotVersion(snapshot Snapshot) error {
+	if snapshot.Version < 1 || snapshot.Version > SnapshotVersion {
+		return errgo.Newf("unsupported snapshot version %d", snapshot.Version)
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package kempclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/juju/errgo"
+)
+
+// These are the kinds of a SnapshotChange.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// SnapshotDiff lists the differences between two snapshots.
+type SnapshotDiff struct {
+	VirtualServices []SnapshotChange
+	RealServers     []SnapshotChange
+	ContentRules    []SnapshotChange
+	Parameters      []SnapshotChange
+}
+
+// SnapshotChange is an added, removed or changed object. Key identifies the
+// object, e.g. the address, port and protocol of a virtual service.
+type SnapshotChange struct {
+	Kind   string
+	Key    string
+	Fields []FieldChange
+}
+
+type FieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// These fields describe the state instead of the configuration or are
+// compared separately.
+var (
+	ignoredVirtualServiceFields = map[string]bool{"ID": true, "Status": true, "Rs": true, "NumberOfRSs": true}
+	ignoredRealServerFields     = map[string]bool{"ID": true, "Status": true, "VirtualService": true}
+	ignoredContentRuleFields    = map[string]bool{"References": true}
+)
+
+// DiffSnapshots compares two snapshots. Virtual services are matched by
+// address, port and protocol, real servers by their virtual service, address
+// and port, content rules and parameters by name.
+func DiffSnapshots(before, after Snapshot) SnapshotDiff {
+	diff := SnapshotDiff{}
+
+	beforeVS := make(map[string]interface{})
+	beforeRS := make(map[string]interface{})
+	for _, vs := range before.VirtualServices {
+		beforeVS[virtualServiceKey(vs)] = vs
+		for _, rs := range vs.Rs {
+			beforeRS[realServerKey(vs, rs)] = rs
+		}
+	}
+	afterVS := make(map[string]interface{})
+	afterRS := make(map[string]interface{})
+	for _, vs := range after.VirtualServices {
+		afterVS[virtualServiceKey(vs)] = vs
+		for _, rs := range vs.Rs {
+			afterRS[realServerKey(vs, rs)] = rs
+		}
+	}
+	diff.VirtualServices = diffObjects(beforeVS, afterVS, ignoredVirtualServiceFields)
+	diff.RealServers = diffObjects(beforeRS, afterRS, ignoredRealServerFields)
+
+	beforeRules := make(map[string]interface{})
+	for _, rule := range before.ContentRules {
+		beforeRules[rule.Name] = rule
+	}
+	afterRules := make(map[string]interface{})
+	for _, rule := range after.ContentRules {
+		afterRules[rule.Name] = rule
+	}
+	diff.ContentRules = diffObjects(beforeRules, afterRules, ignoredContentRuleFields)
+
+	beforeParams := make(map[string]interface{})
+	for name, value := range before.Parameters {
+		beforeParams[name] = value
+	}
+	afterParams := make(map[string]interface{})
+	for name, value := range after.Parameters {
+		afterParams[name] = value
+	}
+	diff.Parameters = diffObjects(beforeParams, afterParams, nil)
+
+	return diff
+}
+
+// DiffWithLive compares the snapshot with the current state of the
+// LoadMaster.
+func (c *Client) DiffWithLive(before Snapshot) (SnapshotDiff, error) {
+	live, err := c.TakeSnapshot()
+	if err != nil {
+		return SnapshotDiff{}, errgo.Mask(err, errgo.Any)
+	}
+
+	return DiffSnapshots(before, live), nil
+}
+
+func (d SnapshotDiff) Empty() bool {
+	return len(d.VirtualServices)+len(d.RealServers)+len(d.ContentRules)+len(d.Parameters) == 0
+}
+
+// WriteTo prints the differences for review, one line per added (+), removed
+// (-) or changed (~) object followed by the changed fields.
+func (d SnapshotDiff) WriteTo(w io.Writer) (int64, error) {
+	buf := &bytes.Buffer{}
+	for _, section := range []struct {
+		name    string
+		changes []SnapshotChange
+	}{
+		{"virtual service", d.VirtualServices},
+		{"real server", d.RealServers},
+		{"content rule", d.ContentRules},
+		{"parameter", d.Parameters},
+	} {
+		for _, change := range section.changes {
+			sign := "~"
+			switch change.Kind {
+			case ChangeAdded:
+				sign = "+"
+			case ChangeRemoved:
+				sign = "-"
+			}
+			fmt.Fprintf(buf, "%s %s %s\n", sign, section.name, change.Key)
+
+			for _, field := range change.Fields {
+				fmt.Fprintf(buf, "    %s: %q -> %q\n", field.Field, field.Before, field.After)
+			}
+		}
+	}
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func virtualServiceKey(vs VirtualService) string {
+	return fmt.Sprintf("%s:%s/%s", vs.IPAddress, vs.Port, vs.Protocol)
+}
+
+func realServerKey(vs VirtualService, rs RealServer) string {
+	return fmt.Sprintf("%s %s:%s", virtualServiceKey(vs), rs.IPAddress, rs.Port)
+}
+
+func diffObjects(before, after map[string]interface{}, ignored map[string]bool) []SnapshotChange {
+	changes := []SnapshotChange{}
+	for key, b := range before {
+		a, ok := after[key]
+		if !ok {
+			changes = append(changes, SnapshotChange{Kind: ChangeRemoved, Key: key})
+			continue
+		}
+
+		if fields := diffFields(b, a, ignored); len(fields) > 0 {
+			changes = append(changes, SnapshotChange{Kind: ChangeChanged, Key: key, Fields: fields})
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			changes = append(changes, SnapshotChange{Kind: ChangeAdded, Key: key})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+// diffFields compares the exported fields of two structs of the same type, or
+// two plain values as field Value.
+func diffFields(before, after interface{}, ignored map[string]bool) []FieldChange {
+	b := reflect.ValueOf(before)
+	a := reflect.ValueOf(after)
+
+	if b.Kind() != reflect.Struct {
+		if fmt.Sprint(before) == fmt.Sprint(after) {
+			return nil
+		}
+		return []FieldChange{{Field: "Value", Before: fmt.Sprint(before), After: fmt.Sprint(after)}}
+	}
+
+	fields := []FieldChange{}
+	for i := 0; i < b.NumField(); i++ {
+		field := b.Type().Field(i)
+		if field.PkgPath != "" || ignored[field.Name] {
+			continue
+		}
+
+		// Comparing the printed values treats nil and empty slices as equal,
+		// which are not preserved by every snapshot format.
+		bv := fmt.Sprintf("%v", b.Field(i).Interface())
+		av := fmt.Sprintf("%v", a.Field(i).Interface())
+		if bv == av {
+			continue
+		}
+
+		fields = append(fields, FieldChange{
+			Field:  field.Name,
+			Before: bv,
+			After:  av,
+		})
+	}
+
+	return fields
+}
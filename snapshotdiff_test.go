@@ -0,0 +1,21 @@
+package kempclient
+
+import "testing"
+
+func TestDiffSnapshotsIgnoresContentRuleReferences(t *testing.T) {
+	rule := NewDeleteHeaderRule("rule", "X-Test")
+	referenced := rule
+	referenced.References = []ContentRuleReference{{VirtualService: 1, Stage: "request"}}
+
+	diff := DiffSnapshots(Snapshot{ContentRules: []ContentRule{rule}}, Snapshot{ContentRules: []ContentRule{referenced}})
+	if len(diff.ContentRules) != 0 {
+		t.Errorf("expected no content rule changes, got %#v", diff.ContentRules)
+	}
+
+	changed := referenced
+	changed.Pattern = "X-Other"
+	diff = DiffSnapshots(Snapshot{ContentRules: []ContentRule{rule}}, Snapshot{ContentRules: []ContentRule{changed}})
+	if len(diff.ContentRules) != 1 || len(diff.ContentRules[0].Fields) != 1 || diff.ContentRules[0].Fields[0].Field != "Pattern" {
+		t.Errorf("expected only the pattern to change, got %#v", diff.ContentRules)
+	}
+}
@@ -20,6 +20,88 @@ type Statistics struct {
 	Totals          Totals                  `xml:"VStotals"`
 	VirtualServices VirtualServiceStatsList `xml:"Vs"`
 	RealServers     RealServerStatsList     `xml:"Rs"`
+	CPU             CPUStats                `xml:"CPU"`
+	Memory          MemoryStats             `xml:"Memory"`
+	Network         NetworkStats            `xml:"Network"`
+	Disk            DiskStats               `xml:"DiskUsage"`
+
+	// Warnings lists the values which could not be parsed. These fields are
+	// left at zero instead of failing the whole request, the Valid method of
+	// their entry reports them as invalid.
+	Warnings []StatisticsWarning `xml:"-"`
+}
+
+// CPUStats represents the CPU usage in percent, in total and per core.
+type CPUStats struct {
+	Total CPUUsage   `xml:"total"`
+	Cores []CPUUsage `xml:",any"`
+}
+
+// CPUUsage represents the usage of a single core or all cores in percent.
+type CPUUsage struct {
+	XMLName   xml.Name `xml:""`
+	User      float64
+	System    float64
+	Idle      float64
+	IOWaiting float64
+
+	invalid fieldSet
+}
+
+// Name returns the name of the core, e.g. cpu0, or total.
+func (u CPUUsage) Name() string {
+	return u.XMLName.Local
+}
+
+// MemoryStats represents the memory usage in MB and percent.
+type MemoryStats struct {
+	Used        int     `xml:"memused"`
+	PercentUsed float64 `xml:"percentmemused"`
+	Free        int     `xml:"memfree"`
+	PercentFree float64 `xml:"percentmemfree"`
+
+	invalid fieldSet
+}
+
+// NetworkStats represents the statistics of all network interfaces.
+type NetworkStats struct {
+	Interfaces []InterfaceStats `xml:",any"`
+}
+
+// InterfaceStats represents the statistics of a network interface. Speed is in
+// Mbit/s, In and Out are the current usage in percent of the speed.
+type InterfaceStats struct {
+	XMLName  xml.Name `xml:""`
+	ID       int      `xml:"ifaceID"`
+	Speed    int      `xml:"speed"`
+	In       float64  `xml:"in"`
+	InBytes  uint64   `xml:"inbytes"`
+	Out      float64  `xml:"out"`
+	OutBytes uint64   `xml:"outbytes"`
+
+	invalid fieldSet
+}
+
+// Name returns the name of the interface, e.g. eth0.
+func (i InterfaceStats) Name() string {
+	return i.XMLName.Local
+}
+
+// DiskStats represents the usage of all partitions.
+type DiskStats struct {
+	Partitions []PartitionStats `xml:"partition"`
+}
+
+// PartitionStats represents the usage of a partition in GB and percent.
+type PartitionStats struct {
+	Name        string  `xml:"name"`
+	Total       float64 `xml:"GBtotal"`
+	Used        float64 `xml:"GBused"`
+	Free        float64 `xml:"GBfree"`
+	PercentUsed float64 `xml:"percentused"`
+	PercentFree float64 `xml:"percentfree"`
+
+	invalid fieldSet
 }
 
 // VirtualServiceStatsList is a list of VirtualServiceStats.
@@ -62,10 +144,12 @@ func (l RealServerStatsList) Swap(i int, j int) {
 
 // Totals represents global statistics data.
 type Totals struct {
-	ConnectionsPerSec int `xml:"ConnsPerSec"`
-	BitsPerSec        int
-	BytesPerSec       int
-	PacketsPerSec     int `xml:"PktsPerSec"`
+	ConnectionsPerSec uint64 `xml:"ConnsPerSec"`
+	BitsPerSec        uint64
+	BytesPerSec       uint64
+	PacketsPerSec     uint64 `xml:"PktsPerSec"`
+
+	invalid fieldSet
 }
 
 // VirtualServiceStats represents statistics for a Virtual Service.
@@ -74,17 +158,19 @@ type VirtualServiceStats struct {
 	Address           string `xml:"VSAddress"`
 	Port              int    `xml:"VSPort"`
 	Protocol          string `xml:"VSProt"`
-	TotalConnections  int    `xml:"TotalConns"`
-	TotalPackets      int    `xml:"TotalPkts"`
-	TotalBytes        int
-	TotalBits         int
+	TotalConnections  uint64 `xml:"TotalConns"`
+	TotalPackets      uint64 `xml:"TotalPkts"`
+	TotalBytes        uint64
+	TotalBits         uint64
 	ActiveConnections int `xml:"ActiveConns"`
 	ConnectionsPerSec int `xml:"ConnsPerSec"`
-	BytesRead         int
-	BytesWritten      int
+	BytesRead         uint64
+	BytesWritten      uint64
 	Enabled           int `xml:"Enable"`
 	WafEnable         int
 	ErrorCode         int
+
+	invalid fieldSet
 }
 
 // RealServerStats represents statistics for a Real Server.
@@ -93,17 +179,19 @@ type RealServerStats struct {
 	RSIndex           int
 	Address           string `xml:"Addr"`
 	Port              int
-	TotalConnections  int `xml:"Conns"`
-	TotalPackets      int `xml:"Pkts"`
-	TotalBytes        int `xml:"Bytes"`
-	TotalBits         int `xml:"Bits"`
-	ActiveConnections int `xml:"ActivConns"`
-	ConnectionsPerSec int `xml:"ConnsPerSec"`
-	BytesRead         int
-	BytesWritten      int
+	TotalConnections  uint64 `xml:"Conns"`
+	TotalPackets      uint64 `xml:"Pkts"`
+	TotalBytes        uint64 `xml:"Bytes"`
+	TotalBits         uint64 `xml:"Bits"`
+	ActiveConnections int    `xml:"ActivConns"`
+	ConnectionsPerSec int    `xml:"ConnsPerSec"`
+	BytesRead         uint64
+	BytesWritten      uint64
 	Enabled           int `xml:"Enable"`
 	Weight            int
 	Persist           int
+
+	invalid fieldSet
 }
 
 // GetStatistics calls the API, and returns a Statistics object.
@@ -120,6 +208,10 @@ func (c *Client) GetStatistics() (Statistics, error) {
 		fmt.Println("DEBUG:", data.Debug)
 	}
 
+	if c.debug && len(data.Data.Warnings) > 0 {
+		fmt.Println("DEBUG: stats warnings", data.Data.Warnings)
+	}
+
 	sort.Sort(data.Data.VirtualServices)
 	sort.Sort(data.Data.RealServers)
 
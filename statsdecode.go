@@ -0,0 +1,267 @@
+package kempclient
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// StatisticsWarning is a value of the statistics which could not be parsed.
+type StatisticsWarning struct {
+	// Section identifies the entry, e.g. "Vs 10.0.0.1:80".
+	Section string
+	Field   string
+	Value   string
+	Message string
+}
+
+func (w StatisticsWarning) String() string {
+	return fmt.Sprintf("%s %s '%s': %s", w.Section, w.Field, w.Value, w.Message)
+}
+
+// fieldSet is a set of fields of a statistics entry by their index. It keeps
+// the entries comparable, unlike a slice or map would.
+type fieldSet uint64
+
+func (f *fieldSet) add(index int) {
+	*f |= 1 << uint(index)
+}
+
+// valid returns false if the named field of t is in the set or does not exist.
+func (f fieldSet) valid(t reflect.Type, name string) bool {
+	field, ok := t.FieldByName(name)
+	if !ok || len(field.Index) != 1 {
+		return false
+	}
+
+	return f&(1<<uint(field.Index[0])) == 0
+}
+
+// Valid returns false if the named field, e.g. "BytesPerSec", could not be
+// parsed. Its value is zero then and must not be used as a counter value.
+func (t Totals) Valid(field string) bool {
+	return t.invalid.valid(reflect.TypeOf(t), field)
+}
+
+// Valid returns false if the named field, e.g. "TotalBytes", could not be
+// parsed. Its value is zero then and must not be used as a counter value.
+func (s VirtualServiceStats) Valid(field string) bool {
+	return s.invalid.valid(reflect.TypeOf(s), field)
+}
+
+// Valid returns false if the named field, e.g. "TotalBytes", could not be
+// parsed. Its value is zero then and must not be used as a counter value.
+func (s RealServerStats) Valid(field string) bool {
+	return s.invalid.valid(reflect.TypeOf(s), field)
+}
+
+// Valid returns false if the named field, e.g. "User", could not be parsed.
+func (u CPUUsage) Valid(field string) bool {
+	return u.invalid.valid(reflect.TypeOf(u), field)
+}
+
+// Valid returns false if the named field, e.g. "Used", could not be parsed.
+func (m MemoryStats) Valid(field string) bool {
+	return m.invalid.valid(reflect.TypeOf(m), field)
+}
+
+// Valid returns false if the named field, e.g. "InBytes", could not be parsed.
+func (i InterfaceStats) Valid(field string) bool {
+	return i.invalid.valid(reflect.TypeOf(i), field)
+}
+
+// Valid returns false if the named field, e.g. "Used", could not be parsed.
+func (p PartitionStats) Valid(field string) bool {
+	return p.invalid.valid(reflect.TypeOf(p), field)
+}
+
+// UnmarshalXML decodes the statistics entries leniently, a value which cannot
+// be parsed is recorded in Warnings and the field is left at zero and marked
+// as invalid in its entry.
+func (s *Statistics) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	add := func(section string, warnings []StatisticsWarning) {
+		for _, w := range warnings {
+			w.Section = section
+			s.Warnings = append(s.Warnings, w)
+		}
+	}
+
+	return decodeChildren(d, func(d *xml.Decoder, t xml.StartElement) error {
+		switch t.Name.Local {
+		case "VStotals":
+			warnings, err := decodeLenient(d, t, &s.Totals, &s.Totals.invalid)
+			add("VStotals", warnings)
+			return err
+		case "Vs":
+			vs := VirtualServiceStats{}
+			warnings, err := decodeLenient(d, t, &vs, &vs.invalid)
+			add(fmt.Sprintf("Vs %s:%d", vs.Address, vs.Port), warnings)
+			s.VirtualServices = append(s.VirtualServices, vs)
+			return err
+		case "Rs":
+			rs := RealServerStats{}
+			warnings, err := decodeLenient(d, t, &rs, &rs.invalid)
+			add(fmt.Sprintf("Rs %d/%d %s:%d", rs.VSIndex, rs.RSIndex, rs.Address, rs.Port), warnings)
+			s.RealServers = append(s.RealServers, rs)
+			return err
+		case "CPU":
+			return decodeChildren(d, func(d *xml.Decoder, t xml.StartElement) error {
+				usage := CPUUsage{}
+				warnings, err := decodeLenient(d, t, &usage, &usage.invalid)
+				if usage.Name() == "total" {
+					add("CPU total", warnings)
+					s.CPU.Total = usage
+				} else {
+					add("CPU "+usage.Name(), warnings)
+					s.CPU.Cores = append(s.CPU.Cores, usage)
+				}
+				return err
+			})
+		case "Memory":
+			warnings, err := decodeLenient(d, t, &s.Memory, &s.Memory.invalid)
+			add("Memory", warnings)
+			return err
+		case "Network":
+			return decodeChildren(d, func(d *xml.Decoder, t xml.StartElement) error {
+				iface := InterfaceStats{}
+				warnings, err := decodeLenient(d, t, &iface, &iface.invalid)
+				add("Network "+iface.Name(), warnings)
+				s.Network.Interfaces = append(s.Network.Interfaces, iface)
+				return err
+			})
+		case "DiskUsage":
+			return decodeChildren(d, func(d *xml.Decoder, t xml.StartElement) error {
+				if t.Name.Local != "partition" {
+					return d.Skip()
+				}
+				partition := PartitionStats{}
+				warnings, err := decodeLenient(d, t, &partition, &partition.invalid)
+				add("DiskUsage "+partition.Name, warnings)
+				s.Disk.Partitions = append(s.Disk.Partitions, partition)
+				return err
+			})
+		}
+
+		return d.Skip()
+	})
+}
+
+// decodeChildren calls decode for every child element until the end of the
+// current element. decode has to consume the child completely.
+func decodeChildren(d *xml.Decoder, decode func(d *xml.Decoder, start xml.StartElement) error) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := decode(d, t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// decodeLenient decodes the child elements of start into the fields of the
+// struct v points to, matching them by their xml tag or name. Values which
+// cannot be parsed are returned as warnings and added to invalid instead of
+// failing.
+func decodeLenient(d *xml.Decoder, start xml.StartElement, v interface{}, invalid *fieldSet) ([]StatisticsWarning, error) {
+	value := reflect.ValueOf(v).Elem()
+	fields := lenientFields(value.Type())
+
+	if i, ok := fields["XMLName"]; ok {
+		value.Field(i).Set(reflect.ValueOf(start.Name))
+	}
+
+	warnings := []StatisticsWarning{}
+	err := decodeChildren(d, func(d *xml.Decoder, t xml.StartElement) error {
+		var raw string
+		if err := d.DecodeElement(&raw, &t); err != nil {
+			return err
+		}
+
+		i, ok := fields[t.Name.Local]
+		if !ok {
+			return nil
+		}
+
+		if message := setLenient(value.Field(i), strings.TrimSpace(raw)); message != "" {
+			invalid.add(i)
+			warnings = append(warnings, StatisticsWarning{
+				Field:   t.Name.Local,
+				Value:   raw,
+				Message: message,
+			})
+		}
+
+		return nil
+	})
+
+	return warnings, err
+}
+
+// lenientFields maps the element names to the index of the exported fields.
+func lenientFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("xml"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" && field.Name != "XMLName" {
+			name = tag
+		}
+		fields[name] = i
+	}
+
+	return fields
+}
+
+// setLenient parses raw into the field and returns a message if it cannot be
+// parsed.
+func setLenient(field reflect.Value, raw string) string {
+	if field.Kind() == reflect.String {
+		field.SetString(raw)
+		return ""
+	}
+
+	if raw == "" {
+		return "empty value"
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err.Error()
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+		if err != nil {
+			return err.Error()
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, field.Type().Bits())
+		if err != nil {
+			return err.Error()
+		}
+		field.SetFloat(n)
+	default:
+		return fmt.Sprintf("unsupported field type %s", field.Type())
+	}
+
+	return ""
+}
@@ -0,0 +1,96 @@
+package kempclient
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func decodeTestStatistics(t *testing.T, body string) Statistics {
+	data := StatisticsResponse{}
+	err := xml.Unmarshal([]byte(`<Response stat="200" code="ok"><Success><Data>`+body+`</Data></Success></Response>`), &data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return data.Data
+}
+
+func TestStatisticsDecodeLenient(t *testing.T) {
+	stats := decodeTestStatistics(t, `
+		<VStotals><ConnsPerSec>3</ConnsPerSec><BytesPerSec>x</BytesPerSec></VStotals>
+		<Vs><Index>1</Index><VSAddress>10.0.0.1</VSAddress><VSPort>80</VSPort><TotalBytes/><TotalConns>12</TotalConns></Vs>
+		<Rs><VSIndex>1</VSIndex><RSIndex>2</RSIndex><Addr>10.0.1.1</Addr><Port>8080</Port><Bytes>100</Bytes></Rs>
+		<CPU><total><User>5</User></total><cpu0><User>-</User></cpu0></CPU>
+		<Network><eth0><ifaceID>0</ifaceID><inbytes>7</inbytes></eth0></Network>
+		<DiskUsage><partition><name>/var</name><GBused>1.5</GBused></partition></DiskUsage>`)
+
+	if len(stats.VirtualServices) != 1 || len(stats.RealServers) != 1 {
+		t.Fatalf("expected one virtual and real server, got %#v", stats)
+	}
+	vs, rs := stats.VirtualServices[0], stats.RealServers[0]
+
+	if vs.TotalConnections != 12 || !vs.Valid("TotalConnections") {
+		t.Errorf("expected valid TotalConnections 12, got %d", vs.TotalConnections)
+	}
+	if vs.Valid("TotalBytes") {
+		t.Errorf("expected TotalBytes to be invalid")
+	}
+	if !rs.Valid("TotalBytes") || rs.TotalBytes != 100 {
+		t.Errorf("expected valid TotalBytes 100, got %d", rs.TotalBytes)
+	}
+	if stats.Totals.Valid("BytesPerSec") || !stats.Totals.Valid("ConnectionsPerSec") {
+		t.Errorf("expected only BytesPerSec of the totals to be invalid")
+	}
+	if stats.CPU.Total.User != 5 || len(stats.CPU.Cores) != 1 || stats.CPU.Cores[0].Valid("User") {
+		t.Errorf("unexpected CPU stats %#v", stats.CPU)
+	}
+	if len(stats.Network.Interfaces) != 1 || stats.Network.Interfaces[0].InBytes != 7 {
+		t.Errorf("unexpected network stats %#v", stats.Network)
+	}
+	if len(stats.Disk.Partitions) != 1 || stats.Disk.Partitions[0].Used != 1.5 {
+		t.Errorf("unexpected disk stats %#v", stats.Disk)
+	}
+
+	expected := []string{
+		"VStotals BytesPerSec 'x'",
+		"Vs 10.0.0.1:80 TotalBytes ''",
+		"CPU cpu0 User '-'",
+	}
+	if len(stats.Warnings) != len(expected) {
+		t.Fatalf("expected %d warnings, got %v", len(expected), stats.Warnings)
+	}
+	for i, w := range stats.Warnings {
+		if got := w.Section + " " + w.Field + " '" + w.Value + "'"; got != expected[i] {
+			t.Errorf("warning %d: expected %s, got %s", i, expected[i], got)
+		}
+	}
+
+	// The entries must stay comparable.
+	totals := stats.Totals
+	if vs != stats.VirtualServices[0] || rs != stats.RealServers[0] || totals != stats.Totals {
+		t.Errorf("expected entries to be equal to themselves")
+	}
+}
+
+func TestStatsSampleSkipsInvalidCounters(t *testing.T) {
+	entry := func(bytes string) Statistics {
+		return decodeTestStatistics(t, `<Vs><Index>1</Index><TotalBytes>`+bytes+`</TotalBytes><TotalConns>5</TotalConns></Vs>`)
+	}
+	first, invalid, last := entry("900000000"), entry(""), entry("900000100")
+
+	for _, pair := range [][2]Statistics{{first, invalid}, {invalid, last}} {
+		rates := computeStatsSample(pair[0], pair[1], 10*time.Second).VirtualServices[1]
+		if rates.Bytes.Valid || rates.Bytes.Reset || rates.Bytes.Delta != 0 {
+			t.Errorf("expected invalid bytes rate to be skipped, got %#v", rates.Bytes)
+		}
+		if !rates.Connections.Valid || rates.Connections.Delta != 0 {
+			t.Errorf("expected valid connections rate, got %#v", rates.Connections)
+		}
+	}
+
+	rates := computeStatsSample(first, last, 10*time.Second).VirtualServices[1]
+	if !rates.Bytes.Valid || rates.Bytes.Delta != 100 || rates.Bytes.PerSecond != 10 {
+		t.Errorf("expected bytes rate of 10/s, got %#v", rates.Bytes)
+	}
+}
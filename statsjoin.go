@@ -0,0 +1,160 @@
+package kempclient
+
+import (
+	"github.com/juju/errgo"
+)
+
+// JoinedVirtualServiceStats nests the statistics of the real servers under the
+// statistics of their virtual service.
+type JoinedVirtualServiceStats struct {
+	Stats       VirtualServiceStats
+	Nickname    string
+	RealServers []RealServerStats
+}
+
+// StatisticsIndex looks up the entries of Statistics by their ID or address
+// without scanning them, see Statistics.Index.
+type StatisticsIndex struct {
+	virtualServices  map[int]VirtualServiceStats
+	vsAddresses      map[vsAddressKey]VirtualServiceStats
+	realServers      map[RealServerKey]RealServerStats
+	rsAddresses      map[rsAddressKey]RealServerStats
+	realServersForVS map[int][]RealServerStats
+}
+
+type vsAddressKey struct {
+	address  string
+	port     int
+	protocol string
+}
+
+type rsAddressKey struct {
+	vsID    int
+	address string
+	port    int
+}
+
+// Index builds the maps to look up the statistics of virtual and real
+// servers. Build it once and use it for all lookups. If an entry occurs more
+// than once, the first one is returned.
+func (s Statistics) Index() *StatisticsIndex {
+	index := &StatisticsIndex{
+		virtualServices:  make(map[int]VirtualServiceStats, len(s.VirtualServices)),
+		vsAddresses:      make(map[vsAddressKey]VirtualServiceStats, len(s.VirtualServices)),
+		realServers:      make(map[RealServerKey]RealServerStats, len(s.RealServers)),
+		rsAddresses:      make(map[rsAddressKey]RealServerStats, len(s.RealServers)),
+		realServersForVS: make(map[int][]RealServerStats),
+	}
+
+	for _, vs := range s.VirtualServices {
+		if _, ok := index.virtualServices[vs.Index]; !ok {
+			index.virtualServices[vs.Index] = vs
+		}
+		key := vsAddressKey{address: vs.Address, port: vs.Port, protocol: vs.Protocol}
+		if _, ok := index.vsAddresses[key]; !ok {
+			index.vsAddresses[key] = vs
+		}
+	}
+
+	for _, rs := range s.RealServers {
+		key := RealServerKey{VSIndex: rs.VSIndex, RSIndex: rs.RSIndex}
+		if _, ok := index.realServers[key]; !ok {
+			index.realServers[key] = rs
+		}
+		addressKey := rsAddressKey{vsID: rs.VSIndex, address: rs.Address, port: rs.Port}
+		if _, ok := index.rsAddresses[addressKey]; !ok {
+			index.rsAddresses[addressKey] = rs
+		}
+		index.realServersForVS[rs.VSIndex] = append(index.realServersForVS[rs.VSIndex], rs)
+	}
+
+	return index
+}
+
+// StatsForVS returns the statistics of the virtual service with the given ID.
+func (i *StatisticsIndex) StatsForVS(id int) (VirtualServiceStats, bool) {
+	vs, ok := i.virtualServices[id]
+	return vs, ok
+}
+
+// StatsForVSAddress returns the statistics of the virtual service listening on
+// the given address, port and protocol.
+func (i *StatisticsIndex) StatsForVSAddress(address string, port int, protocol string) (VirtualServiceStats, bool) {
+	vs, ok := i.vsAddresses[vsAddressKey{address: address, port: port, protocol: protocol}]
+	return vs, ok
+}
+
+// StatsForRS returns the statistics of a real server by the ID of its virtual
+// service and its index.
+func (i *StatisticsIndex) StatsForRS(vsID, rsIndex int) (RealServerStats, bool) {
+	rs, ok := i.realServers[RealServerKey{VSIndex: vsID, RSIndex: rsIndex}]
+	return rs, ok
+}
+
+// StatsForRSAddress returns the statistics of a real server by the ID of its
+// virtual service and its address and port.
+func (i *StatisticsIndex) StatsForRSAddress(vsID int, address string, port int) (RealServerStats, bool) {
+	rs, ok := i.rsAddresses[rsAddressKey{vsID: vsID, address: address, port: port}]
+	return rs, ok
+}
+
+// RealServersForVS returns the statistics of all real servers of the virtual
+// service with the given ID.
+func (i *StatisticsIndex) RealServersForVS(vsID int) []RealServerStats {
+	return append([]RealServerStats{}, i.realServersForVS[vsID]...)
+}
+
+// Join nests the real servers under their virtual services, in the order of
+// the virtual service statistics. The nicknames are taken from the given
+// virtual services, which may be empty. Real servers of a virtual service
+// without statistics are joined under an entry with only the index set.
+func (s Statistics) Join(virtualServices []VirtualService) []JoinedVirtualServiceStats {
+	nicknames := make(map[int]string)
+	for _, vs := range virtualServices {
+		nicknames[vs.ID] = vs.Name
+	}
+
+	joined := []JoinedVirtualServiceStats{}
+	positions := make(map[int]int)
+	for _, vs := range s.VirtualServices {
+		positions[vs.Index] = len(joined)
+		joined = append(joined, JoinedVirtualServiceStats{
+			Stats:       vs,
+			Nickname:    nicknames[vs.Index],
+			RealServers: []RealServerStats{},
+		})
+	}
+
+	for _, rs := range s.RealServers {
+		i, ok := positions[rs.VSIndex]
+		if !ok {
+			i = len(joined)
+			positions[rs.VSIndex] = i
+			joined = append(joined, JoinedVirtualServiceStats{
+				Stats:       VirtualServiceStats{Index: rs.VSIndex},
+				Nickname:    nicknames[rs.VSIndex],
+				RealServers: []RealServerStats{},
+			})
+		}
+
+		joined[i].RealServers = append(joined[i].RealServers, rs)
+	}
+
+	return joined
+}
+
+// GetJoinedStatistics calls GetStatistics and ListVirtualServices and joins
+// them.
+func (c *Client) GetJoinedStatistics() ([]JoinedVirtualServiceStats, error) {
+	stats, err := c.GetStatistics()
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+
+	list, err := c.ListVirtualServices()
+	if err != nil {
+		return nil, errgo.Mask(err, errgo.Any)
+	}
+
+	return stats.Join(list), nil
+}
@@ -0,0 +1,48 @@
+package kempclient
+
+import (
+	"testing"
+)
+
+func TestStatisticsIndex(t *testing.T) {
+	stats := Statistics{
+		VirtualServices: VirtualServiceStatsList{
+			{Index: 1, Address: "10.0.0.1", Port: 80, Protocol: "tcp", TotalConnections: 1},
+			{Index: 2, Address: "10.0.0.1", Port: 443, Protocol: "tcp", TotalConnections: 2},
+		},
+		RealServers: RealServerStatsList{
+			{VSIndex: 1, RSIndex: 1, Address: "10.0.1.1", Port: 8080, TotalConnections: 3},
+			{VSIndex: 1, RSIndex: 2, Address: "10.0.1.2", Port: 8080, TotalConnections: 4},
+			{VSIndex: 2, RSIndex: 3, Address: "10.0.1.1", Port: 8443, TotalConnections: 5},
+		},
+	}
+	index := stats.Index()
+
+	if vs, ok := index.StatsForVS(2); !ok || vs.TotalConnections != 2 {
+		t.Errorf("expected virtual service 2, got %#v, %t", vs, ok)
+	}
+	if _, ok := index.StatsForVS(3); ok {
+		t.Errorf("expected no virtual service 3")
+	}
+	if vs, ok := index.StatsForVSAddress("10.0.0.1", 80, "tcp"); !ok || vs.Index != 1 {
+		t.Errorf("expected virtual service 1, got %#v, %t", vs, ok)
+	}
+	if _, ok := index.StatsForVSAddress("10.0.0.1", 80, "udp"); ok {
+		t.Errorf("expected no udp virtual service")
+	}
+	if rs, ok := index.StatsForRS(1, 2); !ok || rs.TotalConnections != 4 {
+		t.Errorf("expected real server 2 of virtual service 1, got %#v, %t", rs, ok)
+	}
+	if rs, ok := index.StatsForRSAddress(2, "10.0.1.1", 8443); !ok || rs.RSIndex != 3 {
+		t.Errorf("expected real server 3, got %#v, %t", rs, ok)
+	}
+	if _, ok := index.StatsForRSAddress(1, "10.0.1.1", 8443); ok {
+		t.Errorf("expected no real server on port 8443 for virtual service 1")
+	}
+	if realServers := index.RealServersForVS(1); len(realServers) != 2 {
+		t.Errorf("expected 2 real servers, got %#v", realServers)
+	}
+	if realServers := index.RealServersForVS(3); len(realServers) != 0 {
+		t.Errorf("expected no real servers, got %#v", realServers)
+	}
+}
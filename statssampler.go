@@ -0,0 +1,230 @@
+package kempclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+// DefaultStatsWindow is the number of samples a StatsSampler keeps if no
+// window is given.
+const DefaultStatsWindow = 60
+
+// DefaultStatsInterval is the interval a StatsSampler polls at if no valid
+// interval is given.
+const DefaultStatsInterval = 10 * time.Second
+
+// StatsSampler polls GetStatistics and computes the rates of the cumulative
+// counters between two polls, which are more accurate than the per second
+// values reported by the LoadMaster.
+type StatsSampler struct {
+	client   *Client
+	interval time.Duration
+	window   int
+
+	mutex    sync.Mutex
+	previous *Statistics
+	lastTime time.Time
+	samples  []StatsSample
+	err      error
+}
+
+// StatsSample holds the rates between two polls.
+type StatsSample struct {
+	Time     time.Time
+	Interval time.Duration
+
+	// VirtualServices are the rates by the index of the virtual service.
+	VirtualServices map[int]CounterRates
+	RealServers     map[RealServerKey]CounterRates
+}
+
+// RealServerKey identifies the statistics of a real server.
+type RealServerKey struct {
+	VSIndex int
+	RSIndex int
+}
+
+type CounterRates struct {
+	Connections  Rate
+	Packets      Rate
+	Bytes        Rate
+	BytesRead    Rate
+	BytesWritten Rate
+}
+
+// Rate is the change of a counter between two polls.
+type Rate struct {
+	Delta     uint64
+	PerSecond float64
+	// Reset is true if the counter decreased, e.g. after a reboot of the
+	// LoadMaster. Delta is then the current value of the counter.
+	Reset bool
+	// Valid is false if the counter could not be parsed in one of the polls,
+	// see Statistics.Warnings. The rate is not computed then, as the zero
+	// value would look like a reset.
+	Valid bool
+}
+
+func NewStatsSampler(client *Client, interval time.Duration, window int) *StatsSampler {
+	if interval <= 0 {
+		interval = DefaultStatsInterval
+	}
+	if window <= 0 {
+		window = DefaultStatsWindow
+	}
+
+	return &StatsSampler{
+		client:   client,
+		interval: interval,
+		window:   window,
+	}
+}
+
+// Run polls the statistics every interval until the context is done. Failed
+// polls are skipped, see Err.
+func (s *StatsSampler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sample()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample polls the statistics once. The first poll only records the counters,
+// so it returns false.
+func (s *StatsSampler) Sample() (StatsSample, bool, error) {
+	stats, err := s.client.GetStatistics()
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		s.err = err
+		return StatsSample{}, false, errgo.Mask(err, errgo.Any)
+	}
+	s.err = nil
+
+	previous, lastTime := s.previous, s.lastTime
+	s.previous, s.lastTime = &stats, now
+	if previous == nil {
+		return StatsSample{}, false, nil
+	}
+
+	sample := computeStatsSample(*previous, stats, now.Sub(lastTime))
+	sample.Time = now
+
+	s.samples = append(s.samples, sample)
+	if len(s.samples) > s.window {
+		s.samples = s.samples[len(s.samples)-s.window:]
+	}
+
+	return sample, true, nil
+}
+
+// Latest returns the most recent sample.
+func (s *StatsSampler) Latest() (StatsSample, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.samples) == 0 {
+		return StatsSample{}, false
+	}
+
+	return s.samples[len(s.samples)-1], true
+}
+
+// Window returns the samples of the rolling window, oldest first.
+func (s *StatsSampler) Window() []StatsSample {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]StatsSample{}, s.samples...)
+}
+
+// Err returns the error of the last poll, if it failed.
+func (s *StatsSampler) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.err
+}
+
+func computeStatsSample(previous, current Statistics, interval time.Duration) StatsSample {
+	sample := StatsSample{
+		Interval:        interval,
+		VirtualServices: make(map[int]CounterRates),
+		RealServers:     make(map[RealServerKey]CounterRates),
+	}
+
+	previousVS := make(map[int]VirtualServiceStats)
+	for _, vs := range previous.VirtualServices {
+		previousVS[vs.Index] = vs
+	}
+	for _, vs := range current.VirtualServices {
+		p, ok := previousVS[vs.Index]
+		if !ok {
+			continue
+		}
+
+		sample.VirtualServices[vs.Index] = CounterRates{
+			Connections:  counterRate(p.TotalConnections, vs.TotalConnections, p.Valid("TotalConnections") && vs.Valid("TotalConnections"), interval),
+			Packets:      counterRate(p.TotalPackets, vs.TotalPackets, p.Valid("TotalPackets") && vs.Valid("TotalPackets"), interval),
+			Bytes:        counterRate(p.TotalBytes, vs.TotalBytes, p.Valid("TotalBytes") && vs.Valid("TotalBytes"), interval),
+			BytesRead:    counterRate(p.BytesRead, vs.BytesRead, p.Valid("BytesRead") && vs.Valid("BytesRead"), interval),
+			BytesWritten: counterRate(p.BytesWritten, vs.BytesWritten, p.Valid("BytesWritten") && vs.Valid("BytesWritten"), interval),
+		}
+	}
+
+	previousRS := make(map[RealServerKey]RealServerStats)
+	for _, rs := range previous.RealServers {
+		previousRS[RealServerKey{VSIndex: rs.VSIndex, RSIndex: rs.RSIndex}] = rs
+	}
+	for _, rs := range current.RealServers {
+		key := RealServerKey{VSIndex: rs.VSIndex, RSIndex: rs.RSIndex}
+		p, ok := previousRS[key]
+		if !ok {
+			continue
+		}
+
+		sample.RealServers[key] = CounterRates{
+			Connections:  counterRate(p.TotalConnections, rs.TotalConnections, p.Valid("TotalConnections") && rs.Valid("TotalConnections"), interval),
+			Packets:      counterRate(p.TotalPackets, rs.TotalPackets, p.Valid("TotalPackets") && rs.Valid("TotalPackets"), interval),
+			Bytes:        counterRate(p.TotalBytes, rs.TotalBytes, p.Valid("TotalBytes") && rs.Valid("TotalBytes"), interval),
+			BytesRead:    counterRate(p.BytesRead, rs.BytesRead, p.Valid("BytesRead") && rs.Valid("BytesRead"), interval),
+			BytesWritten: counterRate(p.BytesWritten, rs.BytesWritten, p.Valid("BytesWritten") && rs.Valid("BytesWritten"), interval),
+		}
+	}
+
+	return sample
+}
+
+func counterRate(previous, current uint64, valid bool, interval time.Duration) Rate {
+	if !valid {
+		return Rate{}
+	}
+
+	rate := Rate{Valid: true}
+	if current < previous {
+		rate.Delta = current
+		rate.Reset = true
+	} else {
+		rate.Delta = current - previous
+	}
+
+	if interval > 0 {
+		rate.PerSecond = float64(rate.Delta) / interval.Seconds()
+	}
+
+	return rate
+}
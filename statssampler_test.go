@@ -0,0 +1,15 @@
+package kempclient
+
+import (
+	"testing"
+)
+
+func TestNewStatsSamplerDefaults(t *testing.T) {
+	s := NewStatsSampler(NewClient(Config{}), 0, -1)
+	if s.interval != DefaultStatsInterval {
+		t.Errorf("expected interval %s, got %s", DefaultStatsInterval, s.interval)
+	}
+	if s.window != DefaultStatsWindow {
+		t.Errorf("expected window %d, got %d", DefaultStatsWindow, s.window)
+	}
+}
@@ -0,0 +1,162 @@
+package kempclient
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/juju/errgo"
+)
+
+// A content rule is applied to a virtual service in one of three stages.
+// Request rules modify the request before it is sent to the real server,
+// response rules modify the response before it is sent back to the client and
+// pre-process rules are evaluated before the request is routed, e.g. to
+// rewrite the URL.
+//
+// The content rule itself has to exist before it can be attached.
+const (
+	addRequestRuleCommand       = "addrequestrule"
+	deleteRequestRuleCommand    = "delrequestrule"
+	addResponseRuleCommand      = "addresponserule"
+	deleteResponseRuleCommand   = "delresponserule"
+	addPreProcessRuleCommand    = "addprerule"
+	deletePreProcessRuleCommand = "delprerule"
+)
+
+func (c *Client) AddRequestRuleByID(id int, rule string) error {
+	return c.virtualServiceRule(addRequestRuleCommand, virtualServiceIDParameters(id), rule)
+}
+
+func (c *Client) AddRequestRuleByData(ip, port, protocol, rule string) error {
+	return c.virtualServiceRule(addRequestRuleCommand, virtualServiceDataParameters(ip, port, protocol), rule)
+}
+
+func (c *Client) DeleteRequestRuleByID(id int, rule string) error {
+	return c.virtualServiceRule(deleteRequestRuleCommand, virtualServiceIDParameters(id), rule)
+}
+
+func (c *Client) DeleteRequestRuleByData(ip, port, protocol, rule string) error {
+	return c.virtualServiceRule(deleteRequestRuleCommand, virtualServiceDataParameters(ip, port, protocol), rule)
+}
+
+func (c *Client) AddResponseRuleByID(id int, rule string) error {
+	return c.virtualServiceRule(addResponseRuleCommand, virtualServiceIDParameters(id), rule)
+}
+
+func (c *Client) AddResponseRuleByData(ip, port, protocol, rule string) error {
+	return c.virtualServiceRule(addResponseRuleCommand, virtualServiceDataParameters(ip, port, protocol), rule)
+}
+
+func (c *Client) DeleteResponseRuleByID(id int, rule string) error {
+	return c.virtualServiceRule(deleteResponseRuleCommand, virtualServiceIDParameters(id), rule)
+}
+
+func (c *Client) DeleteResponseRuleByData(ip, port, protocol, rule string) error {
+	return c.virtualServiceRule(deleteResponseRuleCommand, virtualServiceDataParameters(ip, port, protocol), rule)
+}
+
+func (c *Client) AddPreProcessRuleByID(id int, rule string) error {
+	return c.virtualServiceRule(addPreProcessRuleCommand, virtualServiceIDParameters(id), rule)
+}
+
+func (c *Client) AddPreProcessRuleByData(ip, port, protocol, rule string) error {
+	return c.virtualServiceRule(addPreProcessRuleCommand, virtualServiceDataParameters(ip, port, protocol), rule)
+}
+
+func (c *Client) DeletePreProcessRuleByID(id int, rule string) error {
+	return c.virtualServiceRule(deletePreProcessRuleCommand, virtualServiceIDParameters(id), rule)
+}
+
+func (c *Client) DeletePreProcessRuleByData(ip, port, protocol, rule string) error {
+	return c.virtualServiceRule(deletePreProcessRuleCommand, virtualServiceDataParameters(ip, port, protocol), rule)
+}
+
+func (c *Client) virtualServiceRule(cmd string, parameters map[string]string, rule string) error {
+	if parameters["vs"] == "" {
+		return errgo.New("The virtual service for the rule is missing")
+	}
+	if rule == "" {
+		return errgo.New("The name of the rule is missing")
+	}
+
+	parameters["rule"] = rule
+
+	data := VirtualServiceResponse{}
+	err := c.Request(cmd, parameters, &data)
+	if err != nil {
+		return errgo.NoteMask(err, fmt.Sprintf("kemp unable to %s for the virtual service '%#v'", cmd, parameters), errgo.Any)
+	}
+
+	if c.debug {
+		fmt.Println("DEBUG:", data.Debug)
+	}
+
+	return nil
+}
+
+// addVirtualServiceRules attaches all rules of the given command to the virtual
+// service identified by parameters. The response is decoded into data. Every
+// attached rule is recorded in j.
+func (c *Client) addVirtualServiceRules(j *journal, cmd string, rules []string, parameters map[string]string, data *VirtualServiceResponse) error {
+	target := ruleTargetParameters(parameters)
+
+	for _, rule := range rules {
+		parameters["rule"] = rule
+		err := c.Request(cmd, parameters, data)
+		if err != nil {
+			return errgo.NoteMask(err, fmt.Sprintf("kemp unable to add rule to the virtual service '%#v'", parameters), errgo.Any)
+		}
+
+		rule := rule
+		j.record(fmt.Sprintf("%s %s", cmd, rule), func() error {
+			return c.virtualServiceRule(undoRuleCommands[cmd], copyParameters(target), rule)
+		})
+	}
+
+	return nil
+}
+
+var undoRuleCommands = map[string]string{
+	addRequestRuleCommand:    deleteRequestRuleCommand,
+	addResponseRuleCommand:   deleteResponseRuleCommand,
+	addPreProcessRuleCommand: deletePreProcessRuleCommand,
+}
+
+func virtualServiceIDParameters(id int) map[string]string {
+	parameters := make(map[string]string)
+	parameters["vs"] = strconv.Itoa(id)
+
+	return parameters
+}
+
+func virtualServiceDataParameters(ip, port, protocol string) map[string]string {
+	parameters := make(map[string]string)
+	parameters["vs"] = ip
+	parameters["port"] = port
+	parameters["prot"] = protocol
+
+	return parameters
+}
+
+// ruleTargetParameters returns the parameters identifying the virtual service
+// of a request, either by its ID or by its address. The port and protocol are
+// left out if the request does not contain them.
+func ruleTargetParameters(parameters map[string]string) map[string]string {
+	target := make(map[string]string)
+	for _, key := range []string{"vs", "port", "prot"} {
+		if value, ok := parameters[key]; ok {
+			target[key] = value
+		}
+	}
+
+	return target
+}
+
+func copyParameters(parameters map[string]string) map[string]string {
+	c := make(map[string]string)
+	for key, value := range parameters {
+		c[key] = value
+	}
+
+	return c
+}
@@ -0,0 +1,15 @@
+package kempclient
+
+import (
+	"testing"
+)
+
+func TestRuleByDataSendsEmptyPortAndProtocol(t *testing.T) {
+	fake, c := newFakeLoadMaster(t)
+
+	if err := c.AddRequestRuleByData("1", "", "", "rule"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectCommands(t, fake.sent(), []string{"addrequestrule port=&prot=&rule=rule&vs=1"})
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net"
 	"strconv"
-	"strings"
 
 	"github.com/juju/errgo"
 )
@@ -56,13 +55,16 @@ type Header struct {
 }
 
 type VirtualServiceParams struct {
-	Name                    string
-	IPAddress               string
-	Port                    string
-	Protocol                string
-	CheckType               string
-	CheckURL                string
-	CheckPort               string
+	Name      string
+	IPAddress string
+	Port      string
+	Protocol  string
+	CheckType string
+	CheckURL  string
+	CheckPort string
+	// HealthCheck configures all health check options and overrides
+	// CheckType, CheckURL and CheckPort, it may be nil.
+	HealthCheck             *HealthCheck
 	SSLAcceleration         bool
 	Transparent             bool
 	AddVia                  string
@@ -71,6 +73,8 @@ type VirtualServiceParams struct {
 	ExtraRequestHeaderValue string
 	Headers                 map[string]string
 	ContentRequestRules     []string
+	ContentResponseRules    []string
+	ContentPreProcessRules  []string
 }
 
 type VirtualServiceResponse struct {
@@ -109,6 +113,10 @@ type VirtualService struct {
 	CheckUse11       string `xml:"CheckUse1.1"`
 	MatchLen         string
 	CheckUseGet      string
+	CheckHost        string
+	CheckPattern     string
+	CheckCodes       string
+	CheckPostData    string
 	SSLRewrite       string
 	VStype           string
 	FollowVSID       int
@@ -121,6 +129,10 @@ type VirtualService struct {
 	NRequestRules    string
 	NResponseRules   string
 	NPreProcessRules string
+	MatchRules       []string `xml:"MatchRules"`
+	RequestRules     []string `xml:"RequestRules"`
+	ResponseRules    []string `xml:"ResponseRules"`
+	PreProcessRules  []string `xml:"PreProcessRules"`
 	EspEnabled       string
 	InputAuthMode    string
 	OutputAuthMode   string
@@ -137,6 +149,11 @@ type VirtualService struct {
 }
 
 func (c *Client) ListVirtualServices() ([]VirtualService, error) {
+	if list, ok := c.cache.get("listvs"); ok {
+		return copyVirtualServices(list.([]VirtualService)), nil
+	}
+
+	generation := c.cache.currentGeneration()
 	parameters := make(map[string]string)
 
 	data := VirtualServiceListResponse{}
@@ -149,9 +166,32 @@ func (c *Client) ListVirtualServices() ([]VirtualService, error) {
 		fmt.Println("DEBUG:", data.Debug)
 	}
 
+	c.cache.set("listvs", copyVirtualServices(data.Data.VS), generation)
+
 	return data.Data.VS, nil
 }
 
+// listVirtualServicesWithRealServers lists the virtual services like
+// ListVirtualServices, but makes sure the real servers are included. listvs
+// does not always contain them, in that case they are read with showvs.
+func (c *Client) listVirtualServicesWithRealServers() ([]VirtualService, error) {
+	list, err := c.ListVirtualServices()
+	if err != nil {
+		return []VirtualService{}, errgo.Mask(err, errgo.Any)
+	}
+
+	for i, vs := range list {
+		if len(vs.Rs) == 0 && vs.NumberOfRSs != "" && vs.NumberOfRSs != "0" {
+			list[i], err = c.ShowVirtualServiceByID(vs.ID)
+			if err != nil {
+				return []VirtualService{}, errgo.Mask(err, errgo.Any)
+			}
+		}
+	}
+
+	return list, nil
+}
+
 func (c *Client) FindVirtualServiceByName(name string) (VirtualService, error) {
 	list, err := c.ListVirtualServices()
 	if err != nil {
@@ -177,10 +217,23 @@ func (c *Client) ShowVirtualServiceByData(ip, port, protocol string) (VirtualSer
 }
 
 func (c *Client) ShowVirtualServiceByID(id int) (VirtualService, error) {
+	key := "showvs/" + strconv.Itoa(id)
+	if vs, ok := c.cache.get(key); ok {
+		return copyVirtualService(vs.(VirtualService)), nil
+	}
+
+	generation := c.cache.currentGeneration()
 	parameters := make(map[string]string)
 	parameters["vs"] = strconv.Itoa(id)
 
-	return c.showVirtualService(parameters)
+	vs, err := c.showVirtualService(parameters)
+	if err != nil {
+		return VirtualService{}, errgo.Mask(err, errgo.Any)
+	}
+
+	c.cache.set(key, copyVirtualService(vs), generation)
+
+	return vs, nil
 }
 
 func (c *Client) showVirtualService(parameters map[string]string) (VirtualService, error) {
@@ -241,14 +294,39 @@ func (c *Client) UpdateVirtualService(id int, vs VirtualServiceParams) (VirtualS
 		parameters["prot"] = vs.Protocol
 	}
 
+	if vs.HealthCheck != nil {
+		if err := vs.HealthCheck.Validate(); err != nil {
+			return VirtualService{}, errgo.Mask(err)
+		}
+	}
+
 	c.mapVirtualServiceParamsToRequestParams(vs, parameters)
 
+	// The header rules are named after the virtual service. If the name is
+	// left unchanged, it has to be read from the LoadMaster.
+	name := vs.Name
+	current := VirtualService{}
+	if len(vs.Headers) > 0 {
+		var err error
+		current, err = c.ShowVirtualServiceByID(id)
+		if err != nil {
+			return VirtualService{}, errgo.Mask(err)
+		}
+		if name == "" {
+			name = current.Name
+		}
+
+		if err := c.deleteLegacyHeaderContentRules(current, vs.Headers); err != nil {
+			return VirtualService{}, errgo.Mask(err)
+		}
+	}
+
 	for key, value := range vs.Headers {
 		// Deleting the content rule http header as there isn't a truly update operation
-		if err := c.DeleteHeaderContentRule(strings.Replace(vs.Name+key, "-", "", -1)); err != nil {
+		if err := c.DeleteHeaderContentRule(HeaderContentRuleName(name, key)); err != nil {
 			fmt.Println(err)
 		}
-		if err := c.AddHeaderContentRule(strings.Replace(vs.Name+key, "-", "", -1), key, value); err != nil {
+		if err := c.AddHeaderContentRule(HeaderContentRuleName(name, key), key, value); err != nil {
 			return VirtualService{}, err
 		}
 	}
@@ -263,25 +341,33 @@ func (c *Client) UpdateVirtualService(id int, vs VirtualServiceParams) (VirtualS
 		fmt.Println("DEBUG:", data.Debug)
 	}
 
-	for key := range vs.Headers {
-		parameters["rule"] = strings.Replace(vs.Name+key, "-", "", -1)
-		err := c.Request("addrequestrule", parameters, &data)
-		if err != nil {
-			return VirtualService{}, errgo.NoteMask(err, fmt.Sprintf("kemp unable to add rule to the virtual service '%#v'", parameters), errgo.Any)
-		}
+	if err := c.addVirtualServiceRules(nil, addRequestRuleCommand, headerContentRuleNames(name, vs.Headers), parameters, &data); err != nil {
+		return VirtualService{}, errgo.Mask(err)
+	}
+	if err := c.addVirtualServiceRules(nil, addRequestRuleCommand, vs.ContentRequestRules, parameters, &data); err != nil {
+		return VirtualService{}, errgo.Mask(err)
+	}
+	if err := c.addVirtualServiceRules(nil, addResponseRuleCommand, vs.ContentResponseRules, parameters, &data); err != nil {
+		return VirtualService{}, errgo.Mask(err)
+	}
+	if err := c.addVirtualServiceRules(nil, addPreProcessRuleCommand, vs.ContentPreProcessRules, parameters, &data); err != nil {
+		return VirtualService{}, errgo.Mask(err)
 	}
 
-	for _, rule := range vs.ContentRequestRules {
-		parameters["rule"] = rule
-		err := c.Request("addrequestrule", parameters, &data)
-		if err != nil {
-			return VirtualService{}, errgo.NoteMask(err, fmt.Sprintf("kemp unable to add rule to the virtual service '%#v'", parameters), errgo.Any)
+	// The rules named after the old name are only removed once the new ones
+	// are attached, so the headers are never missing.
+	if len(vs.Headers) > 0 {
+		if err := c.deleteRenamedHeaderContentRules(current, name, vs.Headers); err != nil {
+			return VirtualService{}, errgo.Mask(err)
 		}
 	}
 
 	return data.VS, nil
 }
 
+// AddVirtualService creates the content rules for the headers, the virtual
+// service and attaches all rules to it. If a step fails after others have been
+// completed, they are undone and a *RollbackError is returned.
 func (c *Client) AddVirtualService(vs VirtualServiceParams) (VirtualService, error) {
 	parameters := make(map[string]string)
 	if net.ParseIP(vs.IPAddress) == nil {
@@ -298,52 +384,72 @@ func (c *Client) AddVirtualService(vs VirtualServiceParams) (VirtualService, err
 	parameters["port"] = vs.Port
 	parameters["prot"] = vs.Protocol
 
-	c.mapVirtualServiceParamsToRequestParams(vs, parameters)
+	if vs.HealthCheck != nil {
+		if err := vs.HealthCheck.Validate(); err != nil {
+			return VirtualService{}, errgo.Mask(err)
+		}
+	}
 
+	c.mapVirtualServiceParamsToRequestParams(vs, parameters)
 
 	if err := c.AddProtoPortHeaderRequestRules(); err != nil {
 		return VirtualService{}, errgo.New("An error occurred when trying to add X-Forwarded-Proto and X-Forwarded-Port delete headers content rules")
 	}
 
+	j := &journal{}
+
 	for key, value := range vs.Headers {
+		name := HeaderContentRuleName(vs.Name, key)
 		// Deleting the content rule http header as there isn't a truly update operation
-		if err := c.DeleteHeaderContentRule(strings.Replace(vs.Name+key, "-", "", -1)); err != nil {
+		if err := c.DeleteHeaderContentRule(name); err != nil {
 			fmt.Println(err)
 		}
-		if err := c.AddHeaderContentRule(strings.Replace(vs.Name+key, "-", "", -1), key, value); err != nil {
-			return VirtualService{}, err
+		if err := c.AddHeaderContentRule(name, key, value); err != nil {
+			return VirtualService{}, j.rollback(err)
 		}
+		j.record("addrule "+name, func() error {
+			return c.DeleteContentRule(name)
+		})
 	}
 
 	data := VirtualServiceResponse{}
 	err := c.Request("addvs", parameters, &data)
 	if err != nil {
-		return VirtualService{}, errgo.NoteMask(err, fmt.Sprintf("kemp unable to add virtual service '%#v'", parameters), errgo.Any)
+		return VirtualService{}, j.rollback(errgo.NoteMask(err, fmt.Sprintf("kemp unable to add virtual service '%#v'", parameters), errgo.Any))
 	}
+	j.record("addvs "+vs.IPAddress+":"+vs.Port, func() error {
+		return c.DeleteVirtualServiceByData(vs.IPAddress, vs.Port, vs.Protocol)
+	})
 
 	if c.debug {
 		fmt.Println("DEBUG:", data.Debug)
 	}
 
-	for key := range vs.Headers {
-		parameters["rule"] = strings.Replace(vs.Name+key, "-", "", -1)
-		err := c.Request("addrequestrule", parameters, &data)
-		if err != nil {
-			return VirtualService{}, errgo.NoteMask(err, fmt.Sprintf("kemp unable to add rule to the virtual service '%#v'", parameters), errgo.Any)
-		}
+	if err := c.addVirtualServiceRules(j, addRequestRuleCommand, headerContentRuleNames(vs.Name, vs.Headers), parameters, &data); err != nil {
+		return VirtualService{}, j.rollback(err)
 	}
-
-	for _, rule := range vs.ContentRequestRules {
-		parameters["rule"] = rule
-		err := c.Request("addrequestrule", parameters, &data)
-		if err != nil {
-			return VirtualService{}, errgo.NoteMask(err, fmt.Sprintf("kemp unable to add rule to the virtual service '%#v'", parameters), errgo.Any)
-		}
+	if err := c.addVirtualServiceRules(j, addRequestRuleCommand, vs.ContentRequestRules, parameters, &data); err != nil {
+		return VirtualService{}, j.rollback(err)
+	}
+	if err := c.addVirtualServiceRules(j, addResponseRuleCommand, vs.ContentResponseRules, parameters, &data); err != nil {
+		return VirtualService{}, j.rollback(err)
+	}
+	if err := c.addVirtualServiceRules(j, addPreProcessRuleCommand, vs.ContentPreProcessRules, parameters, &data); err != nil {
+		return VirtualService{}, j.rollback(err)
 	}
 
 	return data.VS, nil
 }
 
+func headerContentRuleNames(vsName string, headers map[string]string) []string {
+	names := []string{}
+	for key := range headers {
+		names = append(names, HeaderContentRuleName(vsName, key))
+	}
+
+	return names
+}
+
 func (c *Client) mapVirtualServiceParamsToRequestParams(vs VirtualServiceParams, parameters map[string]string) {
 	if vs.Name != "" {
 		parameters["nickname"] = vs.Name
@@ -364,6 +470,9 @@ func (c *Client) mapVirtualServiceParamsToRequestParams(vs VirtualServiceParams,
 	if vs.CheckPort != "" {
 		parameters["checkport"] = vs.CheckPort
 	}
+	if vs.HealthCheck != nil {
+		vs.HealthCheck.setParameters(parameters)
+	}
 
 	if vs.SSLAcceleration {
 		parameters["sslacceleration"] = "Y"
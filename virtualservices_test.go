@@ -0,0 +1,82 @@
+package kempclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// showVirtualServiceHandler answers showvs with a virtual service with the
+// given ID, nickname and request rules.
+func showVirtualServiceHandler(id int, name string, requestRules ...string) func(query url.Values) (int, string) {
+	return func(query url.Values) (int, string) {
+		rules := ""
+		for _, rule := range requestRules {
+			rules += "<RequestRules>" + rule + "</RequestRules>"
+		}
+
+		return http.StatusOK, fmt.Sprintf(`<Response stat="200" code="ok"><Success><Data><Index>%d</Index><NickName>%s</NickName>%s</Data></Success></Response>`, id, name, rules)
+	}
+}
+
+func TestUpdateVirtualServiceHeaderRuleNames(t *testing.T) {
+	oldRule := HeaderContentRuleName("old", "X-Test")
+	newRule := HeaderContentRuleName("new", "X-Test")
+
+	tests := []struct {
+		name     string
+		vsName   string
+		expected []string
+	}{
+		{
+			// The rule keeps being named after the current name.
+			name:   "unchanged name",
+			vsName: "",
+			expected: []string{
+				"delrule name=" + oldRule,
+				"addrule header=X-Test&name=" + oldRule + "&replacement=value&type=1",
+				"addrequestrule rule=" + oldRule + "&sslacceleration=N&transparent=N&vs=1",
+			},
+		},
+		{
+			name:   "same name",
+			vsName: "old",
+			expected: []string{
+				"delrule name=" + oldRule,
+				"addrule header=X-Test&name=" + oldRule + "&replacement=value&type=1",
+				"addrequestrule nickname=old&rule=" + oldRule + "&sslacceleration=N&transparent=N&vs=1",
+			},
+		},
+		{
+			// The rule named after the old name is removed once the new one
+			// is attached.
+			name:   "rename",
+			vsName: "new",
+			expected: []string{
+				"delrule name=" + newRule,
+				"addrule header=X-Test&name=" + newRule + "&replacement=value&type=1",
+				"addrequestrule nickname=new&rule=" + newRule + "&sslacceleration=N&transparent=N&vs=1",
+				"delrequestrule rule=" + oldRule + "&vs=1",
+				"delrule name=" + oldRule,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake, c := newFakeLoadMaster(t)
+			fake.handle("showvs", showVirtualServiceHandler(1, "old", oldRule))
+
+			_, err := c.UpdateVirtualService(1, VirtualServiceParams{
+				Name:    test.vsName,
+				Headers: map[string]string{"X-Test": "value"},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			expectCommands(t, fake.sent("addrule", "delrule", "addrequestrule", "delrequestrule"), test.expected)
+		})
+	}
+}
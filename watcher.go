@@ -0,0 +1,216 @@
+package kempclient
+
+import (
+	"context"
+	"time"
+)
+
+// These are the types of a WatchEvent.
+const (
+	EventVirtualServiceStatusChanged = "VirtualServiceStatusChanged"
+	EventRealServerAdded             = "RealServerAdded"
+	EventRealServerRemoved           = "RealServerRemoved"
+	EventRealServerEnabledChanged    = "RealServerEnabledChanged"
+	EventRealServerHealthChanged     = "RealServerHealthChanged"
+	// EventError is sent if polling failed. The same error is only sent once
+	// until polling succeeds again.
+	EventError = "Error"
+)
+
+// WatchEvent is a change of a virtual service or real server. Previous and
+// Current hold the changed status or enabled state.
+type WatchEvent struct {
+	Type           string
+	Time           time.Time
+	VirtualService VirtualService
+	RealServer     RealServer
+	Previous       string
+	Current        string
+	Err            error
+}
+
+// DefaultWatchInterval is the interval a Watcher polls at if no valid interval
+// is given.
+const DefaultWatchInterval = 10 * time.Second
+
+// Watcher polls the virtual services with their real servers and
+// GetStatistics and sends an event for every change between two polls. The
+// first poll only records the state.
+type Watcher struct {
+	client   *Client
+	interval time.Duration
+	buffer   int
+}
+
+type watchedRealServer struct {
+	vs      VirtualService
+	rs      RealServer
+	enabled string
+}
+
+type watchState struct {
+	virtualServices map[int]VirtualService
+	realServers     map[RealServerKey]watchedRealServer
+}
+
+// NewWatcher returns a watcher polling every interval. buffer is the size of
+// the event channel.
+func NewWatcher(client *Client, interval time.Duration, buffer int) *Watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	return &Watcher{
+		client:   client,
+		interval: interval,
+		buffer:   buffer,
+	}
+}
+
+// Watch polls until the context is done and closes the returned channel
+// afterwards.
+func (w *Watcher) Watch(ctx context.Context) <-chan WatchEvent {
+	events := make(chan WatchEvent, w.buffer)
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		var previous *watchState
+		var lastErr string
+		for {
+			current, err := w.poll()
+			if err != nil {
+				if err.Error() != lastErr {
+					lastErr = err.Error()
+					if !sendEvent(ctx, events, WatchEvent{Type: EventError, Time: time.Now(), Err: err}) {
+						return
+					}
+				}
+			} else {
+				lastErr = ""
+				if previous != nil {
+					for _, event := range diffWatchStates(*previous, current) {
+						if !sendEvent(ctx, events, event) {
+							return
+						}
+					}
+				}
+				previous = &current
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return events
+}
+
+func sendEvent(ctx context.Context, events chan<- WatchEvent, event WatchEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (w *Watcher) poll() (watchState, error) {
+	list, err := w.client.listVirtualServicesWithRealServers()
+	if err != nil {
+		return watchState{}, err
+	}
+
+	stats, err := w.client.GetStatistics()
+	if err != nil {
+		return watchState{}, err
+	}
+	statsEnabled := make(map[RealServerKey]int)
+	for _, rs := range stats.RealServers {
+		statsEnabled[RealServerKey{VSIndex: rs.VSIndex, RSIndex: rs.RSIndex}] = rs.Enabled
+	}
+
+	state := watchState{
+		virtualServices: make(map[int]VirtualService),
+		realServers:     make(map[RealServerKey]watchedRealServer),
+	}
+	for _, vs := range list {
+		state.virtualServices[vs.ID] = vs
+
+		for _, rs := range vs.Rs {
+			key := RealServerKey{VSIndex: vs.ID, RSIndex: rs.ID}
+
+			// listvs does not always report whether the real server is
+			// enabled, the statistics do.
+			enabled := rs.Enable
+			if e, ok := statsEnabled[key]; ok && enabled == "" {
+				enabled = yesNo(e == 1)
+			}
+
+			state.realServers[key] = watchedRealServer{vs: vs, rs: rs, enabled: enabled}
+		}
+	}
+
+	return state, nil
+}
+
+func diffWatchStates(previous, current watchState) []WatchEvent {
+	now := time.Now()
+	events := []WatchEvent{}
+
+	for id, vs := range current.virtualServices {
+		p, ok := previous.virtualServices[id]
+		if ok && p.Status != vs.Status {
+			events = append(events, WatchEvent{
+				Type:           EventVirtualServiceStatusChanged,
+				Time:           now,
+				VirtualService: vs,
+				Previous:       p.Status,
+				Current:        vs.Status,
+			})
+		}
+	}
+
+	for key, rs := range current.realServers {
+		p, ok := previous.realServers[key]
+		if !ok {
+			events = append(events, WatchEvent{Type: EventRealServerAdded, Time: now, VirtualService: rs.vs, RealServer: rs.rs})
+			continue
+		}
+
+		if p.enabled != rs.enabled {
+			events = append(events, WatchEvent{
+				Type:           EventRealServerEnabledChanged,
+				Time:           now,
+				VirtualService: rs.vs,
+				RealServer:     rs.rs,
+				Previous:       p.enabled,
+				Current:        rs.enabled,
+			})
+		}
+		if p.rs.Status != rs.rs.Status {
+			events = append(events, WatchEvent{
+				Type:           EventRealServerHealthChanged,
+				Time:           now,
+				VirtualService: rs.vs,
+				RealServer:     rs.rs,
+				Previous:       p.rs.Status,
+				Current:        rs.rs.Status,
+			})
+		}
+	}
+
+	for key, rs := range previous.realServers {
+		if _, ok := current.realServers[key]; !ok {
+			events = append(events, WatchEvent{Type: EventRealServerRemoved, Time: now, VirtualService: rs.vs, RealServer: rs.rs})
+		}
+	}
+
+	return events
+}
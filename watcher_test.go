@@ -0,0 +1,64 @@
+package kempclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWatcherReadsRealServersMissingFromListvs(t *testing.T) {
+	var mutex sync.Mutex
+	status := "Up"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		vs := `<Index>1</Index><NickName>web</NickName><VSAddress>10.0.0.1</VSAddress><VSPort>80</VSPort><Status>Up</Status><NumberOfRSs>1</NumberOfRSs>`
+		switch strings.TrimPrefix(r.URL.Path, "/") {
+		case "listvs":
+			fmt.Fprintf(w, `<Response stat="200" code="ok"><Success><Data><VS>%s</VS></Data></Success></Response>`, vs)
+		case "showvs":
+			fmt.Fprintf(w, `<Response stat="200" code="ok"><Success><Data>%s<Rs><RsIndex>2</RsIndex><VsIndex>1</VsIndex><Addr>10.0.1.1</Addr><Port>8080</Port><Status>%s</Status><Enable>Y</Enable></Rs></Data></Success></Response>`, vs, status)
+		case "stats":
+			fmt.Fprint(w, `<Response stat="200" code="ok"><Success><Data><Rs><VSIndex>1</VSIndex><RSIndex>2</RSIndex><Enable>1</Enable></Rs></Data></Success></Response>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Response stat="404" code="fail"><Error>Unknown command</Error></Response>`)
+		}
+	}))
+	defer server.Close()
+
+	w := NewWatcher(NewClient(Config{Endpoint: server.URL + "/"}), 0, 0)
+
+	previous, err := w.poll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(previous.realServers) != 1 {
+		t.Fatalf("expected one real server, got %v", previous.realServers)
+	}
+
+	mutex.Lock()
+	status = "Down"
+	mutex.Unlock()
+
+	current, err := w.poll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := diffWatchStates(previous, current)
+	if len(events) != 1 || events[0].Type != EventRealServerHealthChanged || events[0].Previous != "Up" || events[0].Current != "Down" {
+		t.Errorf("expected a single health change from Up to Down, got %#v", events)
+	}
+}
+
+func TestNewWatcherDefaultInterval(t *testing.T) {
+	if w := NewWatcher(NewClient(Config{}), -1, 0); w.interval != DefaultWatchInterval {
+		t.Errorf("expected interval %s, got %s", DefaultWatchInterval, w.interval)
+	}
+}
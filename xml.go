@@ -31,6 +31,10 @@ func (c *Client) parseError(code int, reader io.Reader) error {
 		fmt.Println("DEBUG:", errorResponse.Debug)
 	}
 
+	if isStandbyError(errorResponse.Error) {
+		return errgo.WithCausef(nil, errStandby, "%d - %s", code, errorResponse.Error)
+	}
+
 	return errgo.Newf("%d - %s", code, errorResponse.Error)
 }
 